@@ -2,272 +2,410 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sort"
+	"runtime"
+	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/DeedleFake/bog/internal/cli"
-	"github.com/DeedleFake/bog/multierr"
+	"github.com/gosimple/slug"
 )
 
-// genIndex generates an index of the provided pages using the
-// provided template and writes it to a file under the directory at
-// dst.
-func genIndex(dst string, pages []*PageInfo, tmpl *template.Template, data interface{}) error {
-	file, err := os.Create(filepath.Join(dst, "index.html"))
-	if err != nil {
-		return err
+// extraFlag parses flags consisting of comma-separated key:value
+// pairs, such as -ext-pages. Giving the same key more than once is an
+// error.
+type extraFlag map[string]string
+
+func (f extraFlag) String() string {
+	var sb strings.Builder
+
+	var sep string
+	for _, k := range sortedKeys(f) {
+		fmt.Fprintf(&sb, "%s%v:%v", sep, k, f[k])
+		sep = ","
 	}
-	defer file.Close()
 
-	err = tmpl.Execute(file, map[string]interface{}{
-		"Pages": pages,
-		"Data":  data,
-	})
-	if err != nil {
-		return fmt.Errorf("template execute: %w", err)
+	return sb.String()
+}
+
+func (f extraFlag) Set(v string) error {
+	pairs := strings.Split(v, ",")
+	for _, pair := range pairs {
+		k, v, ok := splitPair(pair, ":")
+		if !ok {
+			return fmt.Errorf("invalid extra specification: %q", pair)
+		}
+		if old, ok := f[k]; ok {
+			return fmt.Errorf("%q given more than once, as both %q and %q", k, old, v)
+		}
+
+		f[k] = v
 	}
+
 	return nil
 }
 
-// printErrors prints the provided intro and then the list of errors,
-// indented, to stderr.
-func printErrors(intro string, errs []error) {
-	fmt.Fprintln(os.Stderr, intro)
-	for _, err := range errs {
-		fmt.Fprintf(os.Stderr, "\t%v\n", err)
+// extrasFlag parses the repeatable -extras flag. It is like extraFlag,
+// but each pair is split around its last colon, rather than its first,
+// so that templates can be given as Windows paths with drive letters,
+// and commas that aren't followed by another pair are treated as part
+// of the previous output path. It also doesn't allow more than one
+// template to be rendered to the same output.
+type extrasFlag map[string]string
+
+func (f extrasFlag) String() string {
+	return extraFlag(f).String()
+}
+
+func (f extrasFlag) Set(v string) error {
+	var pairs []string
+	for _, part := range strings.Split(v, ",") {
+		if (len(pairs) > 0) && !strings.Contains(part, ":") {
+			pairs[len(pairs)-1] += "," + part
+			continue
+		}
+		pairs = append(pairs, part)
 	}
+
+	for _, pair := range pairs {
+		i := strings.LastIndex(pair, ":")
+		if i < 0 {
+			return fmt.Errorf("invalid extra specification: %q", pair)
+		}
+		src, dst := pair[:i], pair[i+1:]
+
+		if old, ok := f[src]; ok {
+			return fmt.Errorf("%q given more than once, as both %q and %q", src, old, dst)
+		}
+		for k, out := range f {
+			if filepath.Clean(out) == filepath.Clean(dst) {
+				return fmt.Errorf("output %q given for both %q and %q", dst, k, src)
+			}
+		}
+
+		f[src] = dst
+	}
+
+	return nil
 }
 
-// extraFlag parses the -extras flag.
-type extraFlag map[string]string
+// setFlag parses the repeatable -set flag.
+type setFlag map[string]string
 
-func (f extraFlag) String() string {
+func (f setFlag) String() string {
 	var sb strings.Builder
 
 	var sep string
-	for k, v := range f {
-		fmt.Fprintf(&sb, "%s%v:%v", sep, k, v)
-		sep = ","
+	for _, k := range sortedKeys(f) {
+		fmt.Fprintf(&sb, "%s%v=%v", sep, k, f[k])
+		sep = " "
 	}
 
 	return sb.String()
 }
 
-func (f extraFlag) Set(v string) error {
-	pairs := strings.Split(v, ",")
-	for _, pair := range pairs {
-		parts := strings.SplitN(pair, ":", 2)
-		if len(parts) < 2 {
-			return fmt.Errorf("invalid extra specification: %q", pair)
-		}
+func (f setFlag) Set(v string) error {
+	key, val, ok := splitPair(v, "=")
+	if !ok {
+		return fmt.Errorf("invalid variable specification: %q", v)
+	}
+
+	f[key] = val
+	return nil
+}
 
-		f[parts[0]] = parts[1]
+// listFlag parses a comma-separated list flag. Each use of the flag
+// replaces the entire list.
+type listFlag []string
+
+func (f listFlag) String() string {
+	return strings.Join(f, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	*f = strings.Split(v, ",")
+	return nil
+}
+
+// multiFlag parses a flag that can be given multiple times, each time
+// with a comma-separated list. Unlike listFlag, each use adds to the
+// list rather than replacing it.
+type multiFlag []string
+
+func (f multiFlag) String() string {
+	return strings.Join(f, ",")
+}
+
+func (f *multiFlag) Set(v string) error {
+	*f = append(*f, strings.Split(v, ",")...)
+	return nil
+}
+
+// splitPair splits pair around the first instance of sep. If sep is
+// not found, ok is false.
+func splitPair(pair, sep string) (k, v string, ok bool) {
+	parts := strings.SplitN(pair, sep, 2)
+	if len(parts) < 2 {
+		return "", "", false
 	}
+	return parts[0], parts[1], true
+}
+
+// jobsFlag parses the -jobs flag. It's a flag.Value, rather than an
+// int, so that its default can be determined at runtime.
+type jobsFlag int
+
+func (f jobsFlag) String() string {
+	return strconv.Itoa(int(f))
+}
 
+func (f *jobsFlag) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*f = jobsFlag(n)
 	return nil
 }
 
 type flags struct {
-	Output   string    `flag:"out,,output directory, or source directory if blank"`
-	Page     string    `flag:"page,,if not blank, path to page template"`
-	Index    string    `flag:"index,,if not blank, path to index template"`
-	GenIndex bool      `flag:"genindex,true,generate an index"`
-	Data     string    `flag:"data,,path to optional YAML data file"`
-	HLStyle  string    `flag:"hlstyle,monokai,Chroma syntax highlighting style"`
-	Extras   extraFlag `flag:"extras,comma-separated template:output pairs of extra files to render"`
+	Output   string     `flag:"out,,output directory, or source directory if blank"`
+	Page     string     `flag:"page,,if not blank, path to page template"`
+	TextPage string     `flag:"textpage,,if not blank, path to text page template"`
+	GemPage  string     `flag:"gemtextpage,,if not blank, path to gemtext page template"`
+	Layouts  string     `flag:"layouts,,if not blank, directory of HTML page templates that pages can select by name with their layout metadata"`
+	ExtPages extraFlag  `flag:"ext-pages,comma-separated extension:template pairs of HTML page templates to use for sources by extension"`
+	Formats  listFlag   `flag:"format,comma-separated output formats for pages that don't list their own: html, text, or gemtext"`
+	Index    string     `flag:"index,,if not blank, path to index template"`
+	GenIndex bool       `flag:"genindex,true,generate an index"`
+	PerPage  int        `flag:"perpage,0,if positive, number of pages to list on each page of the index"`
+	PagePath string     `flag:"page-path,page/%d.html,path under the output directory of each page of the index after the first"`
+	Tags     bool       `flag:"tags,false,generate a page under tags/ for every tag listing the pages with it"`
+	TagTmpl  string     `flag:"tag-template,,if not blank, path to tag page template"`
+	RSS      string     `flag:"rss,,if not blank, path under the output directory to write an RSS feed to"`
+	Atom     string     `flag:"atom,,if not blank, path under the output directory to write an Atom feed to"`
+	Sitemap  string     `flag:"sitemap,,if not blank, path under the output directory to write a sitemap to"`
+	BaseURL  string     `flag:"baseurl,,URL of the root of the site for feeds and sitemaps, or the link in the data file if blank"`
+	DirIndex bool       `flag:"dir-index,false,generate an index in every output subdirectory"`
+	DirTmpl  string     `flag:"dir-index-template,,if not blank, path to directory index template"`
+	Sections bool       `flag:"sectionindex,false,generate an index in every output subdirectory listing only the pages in it"`
+	SectTmpl string     `flag:"section-template,,if not blank, path to section index template, or the index template if blank"`
+	RootIdx  string     `flag:"root-index,all,pages listed by the root index with -sectionindex: all or root"`
+	Minify   bool       `flag:"minify,false,remove comments and collapse whitespace in generated HTML"`
+	Static   string     `flag:"static,,directory of files to copy into the output as is, or static under the source directory if blank"`
+	Force    bool       `flag:"force,false,copy static files even if their copies are up to date"`
+	Data     multiFlag  `flag:"data,comma-separated paths to optional YAML, JSON, or TOML data files, merged in order (repeatable)"`
+	HLStyle  string     `flag:"hlstyle,monokai,Chroma syntax highlighting style"`
+	PagesDir string     `flag:"pages,,if not blank, directory of HTML templates to render with the list of pages"`
+	Extras   extrasFlag `flag:"extras,comma-separated template:output pairs of extra files to render (repeatable)"`
+	Set      setFlag    `flag:"set,key=value pair to set in the template data, overriding the data file (repeatable)"`
+
+	Sort            string    `flag:"sort,time:desc,key[:order] to sort pages by, where order is asc or desc, defaulting to desc for time and asc otherwise; pages missing the key come last"`
+	Collections     extraFlag `flag:"collections,comma-separated collection:key[:order] sorts for collections of pages, where order is asc or desc, defaulting to desc for time and asc otherwise"`
+	Autolink        bool      `flag:"autolink,true,turn bare URLs into links"`
+	Markdown        listFlag  `flag:"md,comma-separated markdown extensions to enable with +name or disable with -name, such as +footnotes,-definition-lists"`
+	Anchors         bool      `flag:"anchors,false,add a link to each heading next to it"`
+	HLClasses       bool      `flag:"hlclasses,false,style highlighted code with CSS classes instead of inline styles and write a stylesheet for them"`
+	HLCSS           string    `flag:"hlcss,chroma.css,path under the output directory to write the stylesheet for -hlclasses to"`
+	LineNos         bool      `flag:"linenos,false,add line numbers to highlighted code"`
+	LineNosTable    bool      `flag:"linenos-table,false,put line numbers in a separate table column so that code can be copied without them"`
+	ExternalLinks   listFlag  `flag:"external-links,comma-separated options for links to absolute URLs: nofollow, noreferrer, noopener, and blank"`
+	ContentTemplate bool      `flag:"content-template,true,execute page content as a template"`
+	IncludeHidden   bool      `flag:"include-hidden,false,include source files whose names begin with a dot"`
+	Exts            listFlag  `flag:"exts,comma-separated source file extensions, in order of precedence"`
+	OnAmbiguous     string    `flag:"on-ambiguous,first,how to handle sources differing only by extension: first or error"`
+	MetaFormat      string    `flag:"meta-format,auto,format of metadata comments: yaml, json, or auto"`
+	SidecarWins     bool      `flag:"sidecar-wins,false,let sidecar metadata files override metadata in pages"`
+	PageDefaults    string    `flag:"page-defaults,,YAML file of default metadata for every page"`
+	ExpandEnv       bool      `flag:"expand-env,false,expand ${VAR} references in data and metadata strings from the environment"`
+	WPM             int       `flag:"wpm,200,reading speed in words per minute for estimating the readingtime of pages"`
+	SlugMaxLen      int       `flag:"slug-max-len,0,if positive, maximum length of generated slugs, truncated at a word boundary"`
+	ErrorFormat     string    `flag:"error-format,text,format of build errors: text, line (file:line: message), or json"`
+	Incremental     bool      `flag:"incremental,false,regenerate pages only if their sources or templates are newer than their outputs or the configuration or the pages that they link to, embed, or list have changed since the build recorded in the manifest"`
+	KeepGoing       bool      `flag:"keep-going,false,generate the pages that loaded successfully even if others failed"`
+	Jobs            jobsFlag  `flag:"jobs,maximum number of pages to load concurrently, or unlimited if not positive"`
+	Serial          bool      `flag:"serial,false,load and generate everything one at a time in a deterministic order"`
+	Verbose         bool      `flag:"verbose,false,also print timing information and the reasons for regenerating files"`
+	Quiet           bool      `flag:"quiet,false,only print errors"`
+	CheckLinks      bool      `flag:"checklinks,false,warn about relative links in generated HTML to missing files or element IDs"`
+	MissingKey      string    `flag:"missingkey,default,what templates do with missing map keys: default, zero, or error, which is recommended for CI and is the default with -strict"`
+	Strict          bool      `flag:"strict,false,treat problems that are otherwise ignored or warned about, such as broken links, mistyped metadata, and missing template keys, as errors"`
+	Drafts          bool      `flag:"drafts,false,publish pages marked as drafts"`
+	Future          bool      `flag:"future,false,publish pages dated in the future"`
+	Expired         bool      `flag:"expired,false,publish pages whose expiry dates have passed"`
+	Clean           bool      `flag:"clean,false,remove files generated by the previous build, according to its manifest, that this build didn't generate"`
+	Manifest        string    `flag:"manifest,.bog/manifest.json,path to write the build manifest to, relative to the output directory, or blank to disable"`
+	Headers         string    `flag:"headers,,if not blank, path under the output directory to write suggested HTTP headers to as JSON"`
+	PageCache       string    `flag:"page-cache,no-cache,Cache-Control header suggested for generated pages"`
+	AssetCache      string    `flag:"asset-cache,max-age=86400,Cache-Control header suggested for assets"`
+
+	Serve   string `flag:"serve,,if not blank, address to serve the output at while rebuilding it when sources change"`
+	Version bool   `flag:"version,false,print version information and exit"`
 
 	Source string `flag:"0,."`
 }
 
+// newFlags returns flags with the defaults of the fields that are
+// flag.Values filled in, ready to be parsed into.
+func newFlags() flags {
+	return flags{
+		Formats:     listFlag(defaultOutputs),
+		Extras:      make(extrasFlag),
+		ExtPages:    make(extraFlag),
+		Collections: make(extraFlag),
+		Set:         make(setFlag),
+		Exts:        listFlag{".md"},
+		Jobs:        jobsFlag(runtime.NumCPU()),
+	}
+}
+
 func main() {
 	ctx := cli.SignalContext(context.Background(), os.Interrupt)
 
-	var flags flags
-	err := cli.ParseFlags(&flags, func(fs *flag.FlagSet) {
+	flags := newFlags()
+	fs, err := cli.Parse(&flags, func(fs *flag.FlagSet) {
 		fmt.Fprintf(fs.Output(), "Usage: %v [options] [source directory]\n\n", os.Args[0])
 		fmt.Fprintln(fs.Output(), "Options:")
 		fs.PrintDefaults()
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: parse flags: %v\n", err)
+		errorf("parse flags: %v", err)
 		os.Exit(2)
 	}
-	if flags.Output == "" {
-		flags.Output = flags.Source
-	}
 
-	var data interface{}
-	if flags.Data != "" {
-		d, err := readYAMLFile(flags.Data)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: read %q: %v\n", flags.Data, err)
-			os.Exit(1)
-		}
-		data = d
+	err = applyConfig(fs, flags.Source)
+	if err != nil {
+		errorf("%v", err)
+		os.Exit(2)
 	}
 
-	files, err := ioutil.ReadDir(flags.Source)
+	err = checkFlags(flags)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: readdir on source directory: %v\n", err)
-		os.Exit(1)
+		errorf("%v", err)
+		os.Exit(2)
 	}
 
-	pageTmpl, err := loadTemplate(template.New("page").Funcs(tmplFuncs), defaultPage, flags.Page)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: load page template: %v\n", err)
-		os.Exit(1)
+	switch {
+	case flags.Verbose:
+		logLvl = levelVerbose
+	case flags.Quiet:
+		logLvl = levelQuiet
 	}
 
-	indexTmpl, err := loadTemplate(template.New("index").Funcs(tmplFuncs), defaultIndex, flags.Index)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: load index template: %v\n", err)
-		os.Exit(1)
+	if flags.Version {
+		fmt.Println(version())
+		return
 	}
 
-	// BUG: This way of doing the parsing results in an inability to use
-	// two files with the same name in different directories.
-	var extraTmpls *template.Template
-	if len(flags.Extras) > 0 {
-		extraSrcs := make([]string, 0, len(flags.Extras))
-		for src := range flags.Extras {
-			extraSrcs = append(extraSrcs, src)
-		}
-		extraTmpls, err = template.New("extras").Funcs(tmplFuncs).ParseFiles(extraSrcs...)
+	// slug's configuration is global, but setting it here makes sure
+	// that both page outputs and the slug-related template functions
+	// agree.
+	slug.MaxLength = flags.SlugMaxLen
+
+	if flags.Serve != "" {
+		err := serve(ctx, flags, flags.Serve, reloadFlags)
+		err = checkInterrupted(ctx, err)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error load extra templates: %v\n", err)
+			printBuildError(flags.ErrorFormat, err)
 			os.Exit(1)
 		}
+		return
 	}
 
-	var pages []*PageInfo
-	pagec := make(chan *PageInfo)
-	pagesDone := make(chan struct{})
-	go func() {
-		defer close(pagesDone)
-
-		for page := range pagec {
-			i := sort.Search(len(pages), func(i int) bool {
-				return page.Meta["time"].(time.Time).After(pages[i].Meta["time"].(time.Time))
-			})
-
-			pages = append(pages, nil)
-			copy(pages[i+1:], pages[i:])
-			pages[i] = page
-		}
-	}()
-
-	eg, ctx := multierr.WithContext(ctx)
-	for _, file := range files {
-		if strings.ToLower(filepath.Ext(file.Name())) != ".md" {
-			continue
-		}
-
-		file := file
-		eg.Go(func() error {
-			path := filepath.Join(flags.Source, file.Name())
-			page, err := LoadPage(path, data, WithStyle(flags.HLStyle))
-			if err != nil {
-				return fmt.Errorf("load %q: %w", path, err)
-			}
+	start := time.Now()
+	site := NewSite(flags)
+	err = site.Build(ctx)
+	err = checkInterrupted(ctx, err)
+	if err != nil {
+		printBuildError(flags.ErrorFormat, err)
+		os.Exit(1)
+	}
+	statusf("%v", site.Summary(time.Since(start)))
+}
 
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case pagec <- page:
-				return nil
-			}
-		})
+// checkInterrupted removes the cancellation errors from err if ctx was
+// canceled by an interrupt, so that only genuine errors are reported.
+// If there aren't any, it exits quietly instead of returning.
+func checkInterrupted(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
 	}
 
-	errs := eg.Wait()
-	if len(errs) > 0 {
-		printErrors("Error(s) while loading pages:", errs)
-		os.Exit(1)
+	err = withoutCanceled(err)
+	if err == nil {
+		fmt.Fprintln(logErrs, "Interrupted")
+		os.Exit(130)
 	}
-	close(pagec)
-	<-pagesDone
+	return err
+}
 
-	err = os.MkdirAll(flags.Output, 0755)
+// applyConfig reads the config file in the source directory, if there
+// is one, and applies it to the flags in fs, which have already been
+// parsed.
+func applyConfig(fs *flag.FlagSet, source string) error {
+	config, err := readConfig(source)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: make output directory: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("read config: %w", err)
 	}
-
-	eg, ctx = multierr.WithContext(ctx)
-
-	eg.Go(func() error {
-		if !flags.GenIndex {
-			return nil
-		}
-
-		err = genIndex(flags.Output, pages, indexTmpl, data)
-		if err != nil {
-			return fmt.Errorf("generate index: %w", err)
-		}
-
-		fmt.Printf("Generated %q\n", filepath.Join(flags.Output, "index.html"))
+	if config == nil {
 		return nil
-	})
+	}
 
-	for _, page := range pages {
-		page := page
-		eg.Go(func() error {
-			path := filepath.Join(flags.Output, page.Output())
-			ok, err := fileExists(path)
-			if ok || (err != nil) {
-				return err
-			}
+	err = config.apply(fs, source)
+	if err != nil {
+		return fmt.Errorf("apply config: %w", err)
+	}
+	return nil
+}
 
-			file, err := os.Create(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+// checkFlags returns an error if flags contains conflicting or
+// invalid options.
+func checkFlags(flags flags) error {
+	if flags.Verbose && flags.Quiet {
+		return errors.New("-verbose and -quiet are mutually exclusive")
+	}
 
-			err = page.Execute(file, pageTmpl, data)
-			if err != nil {
-				return fmt.Errorf("execute %q: %w", page.Input(), err)
-			}
+	if flags.Sections && flags.DirIndex {
+		return errors.New("-sectionindex and -dir-index are mutually exclusive")
+	}
 
-			fmt.Printf("Generated %q\n", path)
-			return nil
-		})
+	if !missingKeyModes[flags.MissingKey] {
+		return fmt.Errorf("unknown missing key mode: %q", flags.MissingKey)
 	}
 
-	for src, dst := range flags.Extras {
-		src, dst := src, dst
-		eg.Go(func() error {
-			path := filepath.Join(flags.Output, dst)
+	if !metaFormats[flags.MetaFormat] {
+		return fmt.Errorf("unknown metadata format: %q", flags.MetaFormat)
+	}
 
-			file, err := os.Create(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-
-			err = extraTmpls.ExecuteTemplate(file, filepath.Base(src), map[string]interface{}{
-				"Data":  data,
-				"Pages": pages,
-			})
-			if err != nil {
-				return fmt.Errorf("execute %q: %w", src, err)
-			}
+	if _, ok := errorFormats[flags.ErrorFormat]; !ok {
+		return fmt.Errorf("unknown error format: %q", flags.ErrorFormat)
+	}
+
+	return nil
+}
 
-			fmt.Printf("Generated %q\n", path)
-			return nil
-		})
+// reloadFlags parses the command line again into a new set of flags
+// and applies the config file to them, so that -serve can pick up
+// changes to the config file without being restarted.
+func reloadFlags() (flags, error) {
+	flags := newFlags()
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	err := cli.ParseFlagSet(fs, os.Args[1:], &flags, nil)
+	if err != nil {
+		return flags, fmt.Errorf("parse flags: %w", err)
 	}
 
-	errs = eg.Wait()
-	if len(errs) > 0 {
-		printErrors("Error(s) while generating output:", errs)
-		os.Exit(1)
+	err = applyConfig(fs, flags.Source)
+	if err != nil {
+		return flags, err
 	}
+
+	return flags, checkFlags(flags)
 }
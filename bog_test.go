@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetFlag(t *testing.T) {
+	f := make(setFlag)
+	for _, v := range []string{"b=2", "a=1", "c=x=y", "a=3"} {
+		err := f.Set(v)
+		if err != nil {
+			t.Fatalf("%q: %v", v, err)
+		}
+	}
+	if got, want := f.String(), "a=3 b=2 c=x=y"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	err := f.Set("novalue")
+	if (err == nil) || !strings.Contains(err.Error(), `"novalue"`) {
+		t.Errorf("expected an error quoting the specification, got %v", err)
+	}
+}
+
+func TestCheckFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{args: nil},
+		{args: []string{"-meta-format", "json"}},
+		{args: []string{"-meta-format", "xml"}, err: `unknown metadata format: "xml"`},
+		{args: []string{"-error-format", "xml"}, err: `unknown error format: "xml"`},
+		{args: []string{"-missingkey", "panic"}, err: `unknown missing key mode: "panic"`},
+		{args: []string{"-verbose", "-quiet"}, err: "mutually exclusive"},
+	}
+	for _, test := range tests {
+		flags, err := parseFlags(test.args...)
+		if err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+
+		err = checkFlags(flags)
+		switch {
+		case test.err == "":
+			if err != nil {
+				t.Errorf("%v: %v", test.args, err)
+			}
+		case (err == nil) || !strings.Contains(err.Error(), test.err):
+			t.Errorf("%v: got error %v, want %q", test.args, err, test.err)
+		}
+	}
+}
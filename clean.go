@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DeedleFake/bog/manifest"
+)
+
+// clean removes the files that were generated by the previous build,
+// as recorded in its manifest, but not by this one, such as the
+// outputs of pages that have since been deleted or renamed. Files that
+// bog didn't generate are never touched, and neither is anything that
+// has the extension of a source file, in case the output directory is
+// the source directory. Directories that are left empty are removed
+// as well.
+func (s *Site) clean() error {
+	if s.flags.Manifest == "" {
+		return errors.New("cleaning requires a manifest to know which files were generated")
+	}
+
+	old, err := manifest.Read(s.manifestPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read previous manifest: %w", err)
+	}
+
+	current := make(map[string]struct{}, len(s.outputs))
+	for _, o := range s.outputs {
+		current[filepath.Clean(o.Path)] = struct{}{}
+	}
+
+	for _, file := range old.Files {
+		path := filepath.Join(s.flags.Output, filepath.FromSlash(file.Path))
+		if _, ok := current[path]; ok {
+			continue
+		}
+		if !isLocal(file.Path) {
+			warnf("not removing %q: outside of the output directory", path)
+			continue
+		}
+		if s.isSourceExt(path) {
+			warnf("not removing %q: looks like a source file", path)
+			continue
+		}
+
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("remove %q: %w", path, err)
+		}
+		infof("Removed %q", path)
+
+		s.removeEmptyDirs(filepath.Dir(path))
+	}
+
+	return nil
+}
+
+// isSourceExt returns true if path has one of the extensions of source
+// files.
+func (s *Site) isSourceExt(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range s.flags.Exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeEmptyDirs removes dir and then each of its parents, up to but
+// not including the output directory, until it reaches one that isn't
+// empty.
+func (s *Site) removeEmptyDirs(dir string) {
+	out := filepath.Clean(s.flags.Output)
+	for dir = filepath.Clean(dir); (dir != out) && strings.HasPrefix(dir, out+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFiles are the names of the optional config file in the source
+// directory, in the order that they're looked for, mapped to their
+// formats.
+var configFiles = []struct {
+	name   string
+	format string
+}{
+	{"bog.yaml", metaYAML},
+	{"bog.yml", metaYAML},
+	{"bog.toml", metaTOML},
+}
+
+// configPaths are the flags whose values are paths, which are treated
+// as relative to the source directory when they're given in a config
+// file.
+var configPaths = map[string]bool{
+	"out":                true,
+	"page":               true,
+	"textpage":           true,
+	"gemtextpage":        true,
+	"index":              true,
+	"tag-template":       true,
+	"dir-index-template": true,
+	"section-template":   true,
+	"data":               true,
+	"static":             true,
+	"pages":              true,
+	"layouts":            true,
+	"page-defaults":      true,
+}
+
+// siteConfig is the contents of a config file. Its keys are the names
+// of the flags that they set.
+type siteConfig struct {
+	// Path is the path of the file that the config was read from.
+	Path string
+
+	// Values maps flag names to the values given for them.
+	Values map[string]interface{}
+}
+
+// readConfig reads the config file from the source directory dir. If
+// there is no config file, it returns nil.
+func readConfig(dir string) (*siteConfig, error) {
+	for _, file := range configFiles {
+		path := filepath.Join(dir, file.name)
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := decodeConfig(data, file.format)
+		if err != nil {
+			return nil, fmt.Errorf("decode %q: %w", path, err)
+		}
+		return &siteConfig{Path: path, Values: values}, nil
+	}
+
+	return nil, nil
+}
+
+// decodeConfig decodes the contents of a config file in the given
+// format.
+func decodeConfig(data []byte, format string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	switch format {
+	case metaTOML:
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		return tree.ToMap(), nil
+
+	default:
+		err := yaml.Unmarshal(data, &values)
+		return values, err
+	}
+}
+
+// apply sets the flags in fs from the config, treating any relative
+// paths as relative to the source directory. Flags that were given on
+// the command line take precedence, except for flags that are maps,
+// such as -extras, whose entries from the config are added unless the
+// command line specified the same key. Keys that don't name a flag
+// are warned about and ignored.
+func (config *siteConfig) apply(fs *flag.FlagSet, source string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	resolve := func(path string) string {
+		if (path == "") || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(source, path)
+	}
+
+	names := make([]string, 0, len(config.Values))
+	for name := range config.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil {
+			warnf("%v: unknown key %q", config.Path, name)
+			continue
+		}
+
+		var err error
+		switch v := config.Values[name].(type) {
+		case map[string]interface{}:
+			err = config.applyMap(f, v, resolve)
+
+		case []interface{}:
+			if given[name] {
+				continue
+			}
+			strs := make([]string, 0, len(v))
+			for _, e := range v {
+				str := fmt.Sprint(e)
+				if configPaths[name] {
+					str = resolve(str)
+				}
+				strs = append(strs, str)
+			}
+			err = f.Value.Set(strings.Join(strs, ","))
+
+		default:
+			if given[name] {
+				continue
+			}
+			str := fmt.Sprint(v)
+			if configPaths[name] {
+				str = resolve(str)
+			}
+			err = f.Value.Set(str)
+		}
+		if err != nil {
+			return fmt.Errorf("%v: invalid value for %q: %w", config.Path, name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMap adds the entries of m to the map flag f, skipping any keys
+// that it already has.
+func (config *siteConfig) applyMap(f *flag.Flag, m map[string]interface{}, resolve func(string) string) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := fmt.Sprint(m[k])
+
+		// The keys of -extras and the values of -ext-pages are template
+		// paths.
+		switch f.Name {
+		case "extras":
+			k = resolve(k)
+		case "ext-pages":
+			v = resolve(v)
+		}
+
+		var err error
+		switch dst := f.Value.(type) {
+		case extraFlag:
+			if _, ok := dst[k]; !ok {
+				err = dst.Set(k + ":" + v)
+			}
+
+		case extrasFlag:
+			if _, ok := dst[k]; !ok {
+				err = dst.Set(k + ":" + v)
+			}
+
+		case setFlag:
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+
+		default:
+			return fmt.Errorf("expected a single value, not a map")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
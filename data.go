@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readDataFile reads the template data from the file at path, which
+// is decoded as JSON or TOML if it has a .json or .toml extension and
+// as YAML otherwise. The data must be a map at the top level. If the
+// file contains no data at all, an empty map is returned.
+//
+// The data is normalized so that it looks the same to templates no
+// matter which format it came from: maps are all
+// map[string]interface{}, whole numbers are ints, including in JSON,
+// and other numbers are float64s.
+func readDataFile(path string) (interface{}, error) {
+	var data interface{}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err = readJSONFile(path)
+	case ".toml":
+		data, err = readTOMLFile(path)
+	default:
+		data, err = readYAMLFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data = normalizeData(data)
+	switch data.(type) {
+	case nil:
+		return make(map[string]interface{}), nil
+	case map[string]interface{}:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("top-level data must be a map, not %v", typeName(data))
+	}
+}
+
+// normalizeData converts the types produced by the different data
+// decoders to the ones described by readDataFile.
+func normalizeData(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalizeData(e)
+		}
+		return m
+
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeData(e)
+		}
+		return v
+
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeData(e)
+		}
+		return v
+
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+
+	case int64:
+		return int(v)
+
+	default:
+		return v
+	}
+}
+
+// mergeData deeply merges src into dst and returns the result. Maps
+// that are in both are merged recursively, and everything else in src
+// overrides the corresponding value in dst. Both must be maps, as
+// returned by readDataFile.
+func mergeData(dst, src interface{}) interface{} {
+	dm, ok1 := dst.(map[string]interface{})
+	sm, ok2 := src.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return src
+	}
+
+	for k, v := range sm {
+		if old, ok := dm[k]; ok {
+			v = mergeData(old, v)
+		}
+		dm[k] = v
+	}
+	return dm
+}
+
+// typeName returns a user-friendly name for the type of a value
+// decoded from a data file.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case []interface{}:
+		return "a list"
+	case map[interface{}]interface{}, map[string]interface{}:
+		return "a map"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int, int64, uint64, float64:
+		return "a number"
+	default:
+		return fmt.Sprintf("a %T", v)
+	}
+}
+
+// setData sets the keys in vars to their corresponding values in
+// data, overwriting any that already exist, and returns the result.
+// If data is not a map, an error is returned.
+func setData(data interface{}, vars map[string]string) (interface{}, error) {
+	d, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data is %v, not a map", typeName(data))
+	}
+
+	for k, v := range vars {
+		d[k] = v
+	}
+	return d, nil
+}
+
+// expandEnv recursively replaces ${VAR} in all of the string values
+// in v with the values of the corresponding environment variables,
+// returning the result. Undefined variables are replaced with empty
+// strings. Maps and slices are modified in place.
+func expandEnv(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return expandBraced(v)
+
+	case map[interface{}]interface{}:
+		for k, e := range v {
+			v[k] = expandEnv(e)
+		}
+		return v
+
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = expandEnv(e)
+		}
+		return v
+
+	case []interface{}:
+		for i, e := range v {
+			v[i] = expandEnv(e)
+		}
+		return v
+
+	default:
+		return v
+	}
+}
+
+// expandBraced replaces ${VAR} in s with the value of the environment
+// variable VAR. Unlike os.ExpandEnv, it leaves $VAR alone, so that
+// things like prices don't need to be escaped.
+func expandBraced(s string) string {
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		sb.WriteString(s[:start])
+		sb.WriteString(os.Getenv(s[start+2 : end]))
+		s = s[end+1:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDataFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    interface{}
+		err     string
+	}{
+		{
+			name:    "data.yaml",
+			content: "title: Blog\ncount: 3\n",
+			want:    map[string]interface{}{"title": "Blog", "count": 3},
+		},
+		{
+			name:    "data.json",
+			content: `{"title": "Blog", "count": 3}`,
+			want:    map[string]interface{}{"title": "Blog", "count": 3},
+		},
+		{
+			name:    "empty.yaml",
+			content: "",
+			want:    map[string]interface{}{},
+		},
+		{
+			name:    "list.yaml",
+			content: "- a\n- b\n",
+			err:     "top-level data must be a map, not a list",
+		},
+		{
+			name:    "list.json",
+			content: `["a", "b"]`,
+			err:     "top-level data must be a map, not a list",
+		},
+		{
+			name:    "scalar.yaml",
+			content: "just a string\n",
+			err:     "top-level data must be a map, not a string",
+		},
+		{
+			name:    "number.json",
+			content: "3",
+			err:     "top-level data must be a map, not a number",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			err := ioutil.WriteFile(path, []byte(test.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := readDataFile(path)
+			if test.err != "" {
+				if (err == nil) || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data, test.want) {
+				t.Errorf("got %#v, want %#v", data, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	defer os.Unsetenv("BOG_TEST_ID")
+	err := os.Setenv("BOG_TEST_ID", "UA-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("BOG_TEST_MISSING")
+
+	data := map[string]interface{}{
+		"id":      "${BOG_TEST_ID}",
+		"missing": "[${BOG_TEST_MISSING}]",
+		"price":   "$5 or $BOG_TEST_ID",
+		"open":    "${BOG_TEST_ID",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"id ${BOG_TEST_ID}", 3},
+		},
+	}
+	want := map[string]interface{}{
+		"id":      "UA-1",
+		"missing": "[]",
+		"price":   "$5 or $BOG_TEST_ID",
+		"open":    "${BOG_TEST_ID",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"id UA-1", 3},
+		},
+	}
+
+	got := expandEnv(data)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
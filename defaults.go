@@ -6,10 +6,10 @@ const (
 <html>
 	<head>
 		<meta name="generator" content="bog" />
-		{{with .Page.Meta.author}}<meta name="author" content={{. | printf "%q"}} />{{end}}
-		{{with .Page.Meta.desc}}<meta name="description" content={{. | printf "%q"}} />{{end}}
+		{{with index .Page.Meta "author"}}<meta name="author" content={{. | printf "%q"}} />{{end}}
+		{{with index .Page.Meta "desc"}}<meta name="description" content={{. | printf "%q"}} />{{end}}
 
-		<title>{{.Page.Meta.title}}{{with .Data.title}} - {{.}}{{end}}</title>
+		<title>{{.Page.Meta.title}}{{with index .Data "title"}} - {{.}}{{end}}</title>
 	</head>
 	<body>
 		{{.Page.Content}}
@@ -21,16 +21,70 @@ const (
 	<head>
 		<meta name="generator" content="bog" />
 
-		<title>Index{{with .Data.title}} - {{.}}{{end}}</title>
+		<title>Index{{with index .Data "title"}} - {{.}}{{end}}</title>
 	<head>
 	<body>
 		{{range .Pages -}}
 			<div>
-				<a href={{.Meta.title | link_to_title | printf "%q"}}>
+				<a href={{printf "%v%v" $.Root .Output | printf "%q"}}>
+					{{- .Meta.title}} ({{.Meta.time.Format "2006-01-02"}}){{"" -}}
+				</a>
+			</div>
+		{{end}}
+		{{- with .Pagination}}
+			<div>
+				{{- with .Prev}}<a href={{printf "%q" .}}>Previous</a> {{end -}}
+				Page {{.Page}} of {{.Total}}
+				{{- with .Next}} <a href={{printf "%q" .}}>Next</a>{{end -}}
+			</div>
+		{{end}}
+	</body>
+</html>`
+
+	defaultTag = `<!DOCTYPE html>
+<html>
+	<head>
+		<meta name="generator" content="bog" />
+
+		<title>{{.Tag}}{{with index .Data "title"}} - {{.}}{{end}}</title>
+	</head>
+	<body>
+		<h1>{{.Tag}}</h1>
+		{{range .Pages -}}
+			<div>
+				<a href={{printf "%v%v" $.Root .Output | printf "%q"}}>
 					{{- .Meta.title}} ({{.Meta.time.Format "2006-01-02"}}){{"" -}}
 				</a>
 			</div>
 		{{end}}
 	</body>
 </html>`
+
+	defaultDirIndex = `<!DOCTYPE html>
+<html>
+	<head>
+		<meta name="generator" content="bog" />
+
+		<title>{{.Dir}}{{with index .Data "title"}} - {{.}}{{end}}</title>
+	</head>
+	<body>
+		<div><a href="../">../</a></div>
+		{{range .Dirs -}}
+			<div><a href={{printf "%v/" . | printf "%q"}}>{{.}}/</a></div>
+		{{end}}
+		{{- range .Pages -}}
+			<div>
+				<a href={{.Output | base | printf "%q"}}>
+					{{- .Meta.title}} ({{.Meta.time.Format "2006-01-02"}}){{"" -}}
+				</a>
+			</div>
+		{{end}}
+	</body>
+</html>`
+
+	defaultText = `{{.Page.Meta.title}}
+
+{{.Page.Content | plaintext}}`
+
+	defaultGemtext = `{{.Page.ContentAs "gemtext"}}`
 )
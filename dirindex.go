@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path"
+	"sort"
+)
+
+// dirIndex is the contents of a single output subdirectory, for use
+// in a directory index.
+type dirIndex struct {
+	// Dir is the slash-separated path of the directory relative to the
+	// output directory.
+	Dir string
+
+	// Pages are the pages that output directly into the directory.
+	Pages []*PageInfo
+
+	// Dirs are the names of the directory's immediate subdirectories
+	// that contain pages, sorted.
+	Dirs []string
+}
+
+// dirIndexes groups pages by the output subdirectories that they
+// output into, returning an index for every subdirectory that
+// contains pages, either directly or in its own subdirectories. The
+// root of the output directory is not included. Pages keep their
+// relative order.
+func dirIndexes(pages []*PageInfo) map[string]*dirIndex {
+	indexes := make(map[string]*dirIndex)
+	get := func(dir string) *dirIndex {
+		index, ok := indexes[dir]
+		if !ok {
+			index = &dirIndex{Dir: dir}
+			indexes[dir] = index
+		}
+		return index
+	}
+
+	subdirs := make(map[string]map[string]struct{})
+	for _, page := range pages {
+		dir := page.OutputDir()
+		if (dir == "") || (dir == ".") {
+			continue
+		}
+		get(dir).Pages = append(get(dir).Pages, page)
+
+		for dir != "." {
+			parent := path.Dir(dir)
+			if parent != "." {
+				get(parent)
+				if subdirs[parent] == nil {
+					subdirs[parent] = make(map[string]struct{})
+				}
+				subdirs[parent][path.Base(dir)] = struct{}{}
+			}
+			dir = parent
+		}
+	}
+
+	for dir, names := range subdirs {
+		index := indexes[dir]
+		for name := range names {
+			index.Dirs = append(index.Dirs, name)
+		}
+		sort.Strings(index.Dirs)
+	}
+
+	return indexes
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SourceError is an error that occurred while processing a specific
+// source file.
+type SourceError struct {
+	// Op describes what was being done with the file, such as "load".
+	Op string
+
+	// Path is the path of the source file.
+	Path string
+
+	// Line is the line in the file at which the error occurred, or 0
+	// if it isn't known.
+	Line int
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (err *SourceError) Error() string {
+	return fmt.Sprintf("%v %q: %v", err.Op, err.Path, err.Err)
+}
+
+func (err *SourceError) Unwrap() error {
+	return err.Err
+}
+
+// contentError is an error in the content template of a page, with
+// its position translated to a line in the page's source.
+type contentError struct {
+	// Line is the line in the page's source, or 0 if it isn't known.
+	Line int
+	Err  error
+}
+
+func (err *contentError) Error() string {
+	if err.Line <= 0 {
+		return err.Err.Error()
+	}
+	return fmt.Sprintf("near source line %v: %v", err.Line, err.Err)
+}
+
+func (err *contentError) Unwrap() error {
+	return err.Err
+}
+
+// sourceError wraps err in a SourceError for the file at path. If err
+// is or wraps a *contentError, the line is taken from that. Otherwise,
+// if err came from a template named after the file, the line number
+// is pulled out of the template's error message.
+func sourceError(op, path string, err error) *SourceError {
+	line := templateLine(err, path)
+	var cerr *contentError
+	if errors.As(err, &cerr) {
+		line = cerr.Line
+	}
+
+	return &SourceError{
+		Op:   op,
+		Path: path,
+		Line: line,
+		Err:  err,
+	}
+}
+
+// withoutCanceled returns err with any context.Canceled errors removed
+// from it, or nil if there's nothing left. If err is a *StageError, the
+// errors in it are filtered individually.
+func withoutCanceled(err error) error {
+	var serr *StageError
+	if !errors.As(err, &serr) {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+
+	var errs []error
+	for _, e := range serr.Errs {
+		if !errors.Is(e, context.Canceled) {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &StageError{Stage: serr.Stage, Errs: errs}
+}
+
+// templateLine finds the line number in an error produced by
+// text/template for the template with the given name. It returns 0 if
+// there isn't one.
+func templateLine(err error, name string) int {
+	msg := err.Error()
+	prefix := "template: " + name + ":"
+	i := strings.Index(msg, prefix)
+	if i < 0 {
+		return 0
+	}
+
+	rest := msg[i+len(prefix):]
+	end := strings.IndexFunc(rest, func(c rune) bool { return (c < '0') || (c > '9') })
+	if end < 0 {
+		end = len(rest)
+	}
+	line, _ := strconv.Atoi(rest[:end])
+	return line
+}
+
+// errorFormats maps the names of the formats accepted by
+// -error-format to the functions that write errors in them. Each is
+// given the stage of the build during which the errors occurred, if
+// known, and the errors themselves.
+var errorFormats = map[string]func(w io.Writer, stage string, errs []error){
+	"text": printErrorsText,
+	"line": printErrorsLine,
+	"json": printErrorsJSON,
+}
+
+// printErrors writes errs to w in the named format, which must be
+// one of those in errorFormats.
+func printErrors(w io.Writer, format string, stage string, errs []error) {
+	errorFormats[format](w, stage, errs)
+}
+
+// printErrorsText writes errors for humans. Multiple errors are
+// listed, indented, after an introduction mentioning the stage.
+func printErrorsText(w io.Writer, stage string, errs []error) {
+	if stage == "" {
+		for _, err := range errs {
+			fmt.Fprintf(w, "Error: %v\n", err)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "Error(s) while %v:\n", stage)
+	for _, err := range errs {
+		fmt.Fprintf(w, "\t%v\n", err)
+	}
+}
+
+// printErrorsLine writes one error per line in the file:line: message
+// format understood by many editors. Errors that aren't associated
+// with a file are prefixed with "bog" instead.
+func printErrorsLine(w io.Writer, stage string, errs []error) {
+	for _, err := range errs {
+		var serr *SourceError
+		switch {
+		case errors.As(err, &serr) && (serr.Line > 0):
+			fmt.Fprintf(w, "%v:%v: %v\n", serr.Path, serr.Line, serr.Err)
+		case errors.As(err, &serr):
+			fmt.Fprintf(w, "%v: %v\n", serr.Path, serr.Err)
+		default:
+			fmt.Fprintf(w, "bog: %v\n", err)
+		}
+	}
+}
+
+// printErrorsJSON writes one JSON object per line for each error.
+func printErrorsJSON(w io.Writer, stage string, errs []error) {
+	type jsonError struct {
+		Stage   string `json:"stage,omitempty"`
+		File    string `json:"file,omitempty"`
+		Line    int    `json:"line,omitempty"`
+		Message string `json:"message"`
+	}
+
+	e := json.NewEncoder(w)
+	e.SetEscapeHTML(false)
+	for _, err := range errs {
+		je := jsonError{Stage: stage, Message: err.Error()}
+
+		var serr *SourceError
+		if errors.As(err, &serr) {
+			je.File = serr.Path
+			je.Line = serr.Line
+			je.Message = serr.Err.Error()
+		}
+
+		e.Encode(je)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStageErrorIs(t *testing.T) {
+	errFailed := errors.New("failed")
+	serr := &StageError{
+		Stage: "testing",
+		Errs:  []error{sourceError("load", "a.md", errFailed), context.Canceled},
+	}
+
+	if !errors.Is(serr, context.Canceled) || !errors.Is(serr, errFailed) {
+		t.Errorf("%v doesn't match its errors", serr)
+	}
+	if errors.Is(serr, os.ErrNotExist) {
+		t.Errorf("%v matches %v", serr, os.ErrNotExist)
+	}
+
+	var src *SourceError
+	if !errors.As(serr, &src) || (src.Path != "a.md") {
+		t.Errorf("couldn't find the source error in %v", serr)
+	}
+}
+
+func TestWithoutCanceled(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Canceled", context.Canceled, nil},
+		{"Other", errFailed, errFailed},
+		{"AllCanceled", &StageError{Stage: "testing", Errs: []error{context.Canceled, context.Canceled}}, nil},
+		{
+			"Mixed",
+			&StageError{Stage: "testing", Errs: []error{context.Canceled, errFailed}},
+			&StageError{Stage: "testing", Errs: []error{errFailed}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := withoutCanceled(test.err)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrintErrors(t *testing.T) {
+	errs := []error{
+		&SourceError{Op: "load", Path: "a.md", Line: 3, Err: errors.New("bad template")},
+		sourceError("load", "b.md", errors.New(`has "quotes" & <html>`)),
+		errors.New("no page"),
+	}
+	tests := []struct {
+		format string
+		stage  string
+		want   string
+	}{
+		{
+			format: "text",
+			stage:  "loading pages",
+			want: `Error(s) while loading pages:
+	load "a.md": bad template
+	load "b.md": has "quotes" & <html>
+	no page
+`,
+		},
+		{
+			format: "text",
+			want: `Error: load "a.md": bad template
+Error: load "b.md": has "quotes" & <html>
+Error: no page
+`,
+		},
+		{
+			format: "line",
+			stage:  "loading pages",
+			want: `a.md:3: bad template
+b.md: has "quotes" & <html>
+bog: no page
+`,
+		},
+		{
+			format: "json",
+			stage:  "loading pages",
+			want: `{"stage":"loading pages","file":"a.md","line":3,"message":"bad template"}
+{"stage":"loading pages","file":"b.md","message":"has \"quotes\" & <html>"}
+{"stage":"loading pages","message":"no page"}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			printErrors(&buf, test.format, test.stage, errs)
+			if got := buf.String(); got != test.want {
+				t.Errorf("got:\n%v\nwant:\n%v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// excerptLength is the maximum length, in runes, of the excerpts of
+// page content used in feeds for pages without a "desc".
+const excerptLength = 200
+
+// dataString returns the string value of the top-level key in the
+// template data, or an empty string if it isn't set.
+func dataString(data interface{}, key string) string {
+	var v interface{}
+	switch data := data.(type) {
+	case map[interface{}]interface{}:
+		v = data[key]
+	case map[string]interface{}:
+		v = data[key]
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// siteURL joins the slash-separated path p, relative to the output
+// directory, onto base, the URL of the root of the site. If base is
+// empty, p is returned as is, producing the same relative links as
+// the index.
+func siteURL(base, p string) string {
+	if base == "" {
+		return p
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(p, "/")
+}
+
+// pageDesc returns the description of a page for use in feeds, which
+// is its "desc" metadata if it has any and an excerpt of its content
+// otherwise.
+func pageDesc(page *PageInfo) string {
+	if desc, ok := page.Meta["desc"].(string); ok {
+		return desc
+	}
+	return truncate(excerptLength, collapseSpace(stripHTML(page.Content)))
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Generator     string    `xml:"generator"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// genRSS writes an RSS 2.0 feed of pages to w. The channel's title
+// and description come from the "title" and "description" keys in
+// data, and its link is base, the URL of the root of the site, which
+// is also used as the base of the links to the pages. Text is escaped
+// by the XML encoder, so HTML in descriptions is shown as text by
+// aggregators rather than being interpreted.
+func genRSS(w io.Writer, pages []*PageInfo, data interface{}, base string, updated time.Time) error {
+	feed := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       dataString(data, "title"),
+			Link:        base,
+			Description: dataString(data, "description"),
+			Generator:   "bog",
+			Items:       make([]rssItem, 0, len(pages)),
+		},
+	}
+	if !updated.IsZero() {
+		feed.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, page := range pages {
+		link := siteURL(base, page.Output())
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       fmt.Sprint(page.Meta["title"]),
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: base != "", Value: link},
+			PubDate:     page.Meta["time"].(time.Time).Format(time.RFC1123Z),
+			Description: pageDesc(page),
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "\t")
+	err = e.Encode(feed)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Gen     string      `xml:"generator"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Summary string      `xml:"summary"`
+}
+
+// atomAuthorOf returns an Atom author with the given name, or nil if
+// the name is empty.
+func atomAuthorOf(name string) *atomAuthor {
+	if name == "" {
+		return nil
+	}
+	return &atomAuthor{Name: name}
+}
+
+// genAtom writes an Atom 1.0 feed of pages to w. self is the
+// slash-separated path of the feed relative to the output directory
+// and base is the URL of the root of the site. The feed's title comes
+// from the "title" key in data, and each entry's ID is its link. Entries
+// are attributed to the "author" in their metadata or, if they don't
+// have one, the feed is attributed to the "author" in data, as Atom
+// requires one or the other. If there's no author in data either, the
+// feed is attributed to the site's title instead. The feed's updated
+// time is the time of the newest page.
+func genAtom(w io.Writer, pages []*PageInfo, data interface{}, base, self string) error {
+	feed := atomFeed{
+		Title: dataString(data, "title"),
+		ID:    siteURL(base, ""),
+		Links: []atomLink{
+			{Rel: "self", Href: siteURL(base, self)},
+			{Rel: "alternate", Href: siteURL(base, "")},
+		},
+		Author:  atomAuthorOf(dataString(data, "author")),
+		Gen:     "bog",
+		Entries: make([]atomEntry, 0, len(pages)),
+	}
+
+	var updated time.Time
+	for _, page := range pages {
+		t := page.Meta["time"].(time.Time)
+		if t.After(updated) {
+			updated = t
+		}
+
+		author, _ := page.Meta["author"].(string)
+		link := siteURL(base, page.Output())
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   fmt.Sprint(page.Meta["title"]),
+			ID:      link,
+			Link:    atomLink{Rel: "alternate", Href: link},
+			Updated: t.Format(time.RFC3339),
+			Author:  atomAuthorOf(author),
+			Summary: pageDesc(page),
+		})
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+
+	if feed.Author == nil {
+		for _, entry := range feed.Entries {
+			if entry.Author == nil {
+				feed.Author = atomAuthorOf(feed.Title)
+				break
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "\t")
+	err = e.Encode(feed)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestGenAtomAuthor(t *testing.T) {
+	page := func(author string) *PageInfo {
+		meta := map[string]interface{}{
+			"title": "Page",
+			"time":  time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		}
+		if author != "" {
+			meta["author"] = author
+		}
+		return &PageInfo{Path: "page.md", Meta: meta, defaultOutputs: []string{"html"}}
+	}
+
+	tests := []struct {
+		name  string
+		data  map[string]interface{}
+		pages []*PageInfo
+		feed  string
+	}{
+		{"Data", map[string]interface{}{"title": "Site", "author": "Someone"}, []*PageInfo{page("")}, "Someone"},
+		{"Title", map[string]interface{}{"title": "Site"}, []*PageInfo{page("Writer"), page("")}, "Site"},
+		{"Entries", map[string]interface{}{"title": "Site"}, []*PageInfo{page("Writer")}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := genAtom(&buf, test.pages, test.data, "https://example.com/", "atom.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var feed atomFeed
+			err = xml.Unmarshal(buf.Bytes(), &feed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			if feed.Author != nil {
+				got = feed.Author.Name
+			}
+			if got != test.feed {
+				t.Errorf("feed author is %q, not %q", got, test.feed)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/DeedleFake/bog/markdown"
+	"github.com/russross/blackfriday/v2"
+)
+
+// An outputFormat is a format in which a page can be generated.
+type outputFormat struct {
+	// Ext is the extension of the generated file, including the
+	// leading dot.
+	Ext string
+
+	// Template is the source of the default page template for the
+	// format.
+	Template string
+
+	// Renderer, if not nil, returns a renderer that is used to render
+	// a separate copy of the content of pages output in the format,
+	// which is available via PageInfo.ContentAs. If it is nil, the
+	// format uses the regular HTML content.
+	Renderer func() blackfriday.Renderer
+}
+
+// outputFormats maps format names, as used in the "outputs" metadata
+// of a page, to the formats themselves.
+var outputFormats = map[string]outputFormat{
+	"html": {Ext: ".html", Template: defaultPage},
+	"text": {Ext: ".txt", Template: defaultText},
+	"gemtext": {
+		Ext:      ".gmi",
+		Template: defaultGemtext,
+		Renderer: func() blackfriday.Renderer { return markdown.NewGemtextRenderer() },
+	},
+}
+
+// defaultOutputs are the formats that a page is generated in if it
+// doesn't list any explicitly and no others were configured.
+var defaultOutputs = []string{"html"}
+
+// checkFormats returns an error if any of the provided formats are
+// not known.
+func checkFormats(formats []string) error {
+	for _, format := range formats {
+		if _, ok := outputFormats[format]; !ok {
+			return fmt.Errorf("unknown output format %q", format)
+		}
+	}
+	return nil
+}
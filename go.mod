@@ -4,9 +4,11 @@ go 1.15
 
 require (
 	github.com/Depado/bfchroma v1.3.0
-	github.com/alecthomas/chroma v0.8.1 // indirect
+	github.com/alecthomas/chroma v0.8.1
 	github.com/dlclark/regexp2 v1.4.0 // indirect
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gosimple/slug v1.9.0
+	github.com/pelletier/go-toml v1.8.1
 	github.com/russross/blackfriday/v2 v2.0.1
 	golang.org/x/net v0.0.0-20201020065357-d65d470038a5
 	gopkg.in/yaml.v2 v2.3.0
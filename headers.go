@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An output is a record of a file generated by a build.
+type output struct {
+	// Path is the path that the file was written to.
+	Path string
+
+	// ModTime is the time at which the file's contents were last
+	// changed, as best as can be determined from its sources.
+	ModTime time.Time
+
+	// Page is true if the file is a page or an index of pages, as
+	// opposed to an asset, such as a static file, a stylesheet, or a
+	// feed. It is set by the code that renders pages.
+	Page bool
+
+	// Sources are the paths of the files that the file was generated
+	// from.
+	Sources []string
+
+	// Hash is the hex-encoded SHA-256 hash of the file's contents.
+	Hash string
+
+	// Deps summarizes the other pages that the file depends on. See
+	// pageDeps.
+	Deps string
+}
+
+// contentType returns the MIME type of the file at path based on its
+// extension.
+func contentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".gmi":
+		return "text/gemini; charset=utf-8"
+	}
+
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// headerPolicy configures the headers suggested for generated files.
+type headerPolicy struct {
+	// PageCache is the Cache-Control value for generated pages.
+	PageCache string
+
+	// AssetCache is the Cache-Control value for assets.
+	AssetCache string
+}
+
+// headers returns the suggested HTTP headers for o.
+func (p headerPolicy) headers(o output) map[string]string {
+	cache := p.AssetCache
+	if o.Page {
+		cache = p.PageCache
+	}
+
+	h := map[string]string{
+		"Content-Type": contentType(o.Path),
+	}
+	if cache != "" {
+		h["Cache-Control"] = cache
+	}
+	if !o.ModTime.IsZero() {
+		h["Last-Modified"] = o.ModTime.UTC().Format(http.TimeFormat)
+	}
+	return h
+}
+
+// marshalHeaders produces a JSON document mapping the slash-separated
+// path of each of the outputs, relative to root, to its suggested
+// headers.
+func marshalHeaders(root string, outputs []output, policy headerPolicy) ([]byte, error) {
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].Path < outputs[j].Path
+	})
+
+	m := make(map[string]map[string]string, len(outputs))
+	for _, o := range outputs {
+		rel, err := filepath.Rel(root, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		m[filepath.ToSlash(rel)] = policy.headers(o)
+	}
+
+	return json.MarshalIndent(m, "", "\t")
+}
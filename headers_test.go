@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildHeadersCache(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"page.md":          "# Page\n",
+		"static/style.css": "body {}\n",
+	} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out,
+		"-headers", "headers.json",
+		"-page-cache", "no-cache",
+		"-asset-cache", "max-age=60",
+		"-hlclasses",
+		"-rss", "feed.xml",
+	)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(out, "headers.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers map[string]map[string]string
+	err = json.Unmarshal(data, &headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"page.html":  "no-cache",
+		"index.html": "no-cache",
+		"style.css":  "max-age=60",
+		"chroma.css": "max-age=60",
+		"feed.xml":   "max-age=60",
+	} {
+		var got string
+		for path, h := range headers {
+			if filepath.Base(path) == name {
+				got = h["Cache-Control"]
+			}
+		}
+		if got != want {
+			t.Errorf("%v: Cache-Control is %q, not %q", name, got, want)
+		}
+	}
+}
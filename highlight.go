@@ -0,0 +1,14 @@
+package main
+
+import (
+	"io"
+
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
+)
+
+// genHighlightCSS writes the stylesheet for code highlighted with CSS
+// classes in the named Chroma style to w.
+func genHighlightCSS(w io.Writer, style string) error {
+	return chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(w, styles.Get(style))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// stripHTML returns the text content of an HTML fragment with all of
+// the tags removed and entities decoded.
+func stripHTML(src string) string {
+	var sb strings.Builder
+
+	t := html.NewTokenizer(strings.NewReader(src))
+	for {
+		switch t.Next() {
+		case html.ErrorToken:
+			if t.Err() != io.EOF {
+				// An HTML tokenizer can only fail because of the
+				// underlying reader, which can't happen with a
+				// strings.Reader.
+				panic(t.Err())
+			}
+			return sb.String()
+
+		case html.TextToken:
+			sb.Write(t.Text())
+		}
+	}
+}
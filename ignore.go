@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile is the name of the files that list paths to ignore.
+const ignoreFile = ".bogignore"
+
+// An ignoreRule is a single pattern from an ignore file.
+type ignoreRule struct {
+	// pattern is the slash-separated pattern, with any leading "!",
+	// leading slash, and trailing slash removed.
+	pattern string
+
+	// negate is true if the pattern started with a "!", meaning that
+	// matching paths should not be ignored after all.
+	negate bool
+
+	// dirOnly is true if the pattern ended with a slash, meaning that
+	// it only matches directories.
+	dirOnly bool
+
+	// anchored is true if the pattern contained a slash anywhere but
+	// at the end, meaning that it is matched against the whole path
+	// relative to the ignore file's directory instead of just against
+	// the last element.
+	anchored bool
+}
+
+// parseIgnoreRule parses a line from an ignore file. If the line is
+// blank or a comment, ok is false.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if (line == "") || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, `\`)
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	rule.pattern = line
+	return rule, line != ""
+}
+
+// match returns true if the rule matches the slash-separated path rel,
+// which is relative to the directory that contained the rule.
+func (rule ignoreRule) match(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+
+	if !rule.anchored {
+		ok, _ := path.Match(rule.pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches a pattern split on slashes against a path
+// split on slashes. A "**" segment matches zero or more path
+// segments; every other segment is matched using path.Match.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		ok, _ := path.Match(pattern[0], segments[0])
+		if !ok {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// ignoreSet is the set of rules from a single ignore file.
+type ignoreSet struct {
+	// dir is the slash-separated directory containing the ignore
+	// file, relative to the source root. It is empty for the root
+	// itself.
+	dir   string
+	rules []ignoreRule
+}
+
+// An ignorer decides which paths in a source tree should be ignored
+// based on the ignore files found in it. Rules from ignore files in
+// deeper directories take precedence over those from shallower ones,
+// and later rules in a file take precedence over earlier ones.
+type ignorer struct {
+	root string
+	sets []ignoreSet
+}
+
+// Load reads the ignore file in dir, a slash-separated path relative
+// to the source root, if there is one.
+func (ig *ignorer) Load(dir string) error {
+	file, err := os.Open(filepath.Join(ig.root, filepath.FromSlash(dir), ignoreFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	set := ignoreSet{dir: dir}
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		rule, ok := parseIgnoreRule(s.Text())
+		if ok {
+			set.rules = append(set.rules, rule)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	ig.sets = append(ig.sets, set)
+	return nil
+}
+
+// Ignored returns true if the slash-separated path rel, relative to
+// the source root, should be ignored.
+func (ig *ignorer) Ignored(rel string, isDir bool) (ignored bool) {
+	for _, set := range ig.sets {
+		sub := rel
+		if set.dir != "" {
+			if !strings.HasPrefix(rel, set.dir+"/") {
+				continue
+			}
+			sub = rel[len(set.dir)+1:]
+		}
+
+		for _, rule := range set.rules {
+			if rule.match(sub, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+
+	return ignored
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/DeedleFake/bog/manifest"
+)
+
+// pageTemplateSource returns the path of the file that the template
+// returned by pageTemplate for the same arguments was loaded from, or
+// an empty string if it is a built-in default.
+func (s *Site) pageTemplateSource(page *PageInfo, format string) string {
+	if format == "html" {
+		if tmpl, ok := s.layoutTmpls[page.Layout()]; ok {
+			return filepath.Join(s.flags.Layouts, tmpl.Name())
+		}
+		for ext, path := range s.flags.ExtPages {
+			if strings.EqualFold(ext, filepath.Ext(page.Path)) {
+				return path
+			}
+		}
+	}
+
+	switch format {
+	case "html":
+		return s.flags.Page
+	case "text":
+		return s.flags.TextPage
+	case "gemtext":
+		return s.flags.GemPage
+	default:
+		return ""
+	}
+}
+
+// inputsModTime returns the latest modification time of any of the
+// files that the output of page in the given format depends on: its
+// source, its sidecar file, its page template, the data files, and the
+// page defaults.
+func (s *Site) inputsModTime(page *PageInfo, format string) (time.Time, error) {
+	t := page.InputInfo.ModTime()
+
+	paths := append(sidecarPaths(page.Path), s.pageTemplateSource(page, format), s.flags.PageDefaults)
+	paths = append(paths, s.flags.Data...)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return t, err
+		}
+		if info.ModTime().After(t) {
+			t = info.ModTime()
+		}
+	}
+
+	return t, nil
+}
+
+// stale returns the reason that the output of page in the given
+// format described by o needs to be regenerated, or an empty string if
+// it exists and is up to date. An output is stale if it's older than
+// any of its inputs or if the other pages that it depends on, as
+// summarized by o.Deps, have changed since the previous build
+// according to its manifest. Every output is stale if the
+// configuration of the build has changed, as summarized by
+// configHash, which also means that every output is stale if there is
+// no previous manifest to compare against.
+func (s *Site) stale(o output, page *PageInfo, format string) (string, error) {
+	info, err := os.Stat(o.Path)
+	if os.IsNotExist(err) {
+		return "missing", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if s.reconfigured {
+		return "the configuration changed", nil
+	}
+
+	t, err := s.inputsModTime(page, format)
+	if err != nil {
+		return "", err
+	}
+	if !info.ModTime().After(t) {
+		return "older than its inputs", nil
+	}
+
+	rel, err := filepath.Rel(s.flags.Output, o.Path)
+	if err != nil {
+		return "", err
+	}
+	prev, ok := s.previous[filepath.ToSlash(rel)]
+	if (!ok && (o.Deps != "")) || (ok && (prev.Deps != o.Deps)) {
+		return "the pages that it depends on changed", nil
+	}
+
+	return "", nil
+}
+
+// readPrevious returns the files in the previous build's manifest by
+// path and the summary of that build's configuration, or nil and an
+// empty string if there isn't one.
+func (s *Site) readPrevious() (map[string]manifest.File, string, error) {
+	if s.flags.Manifest == "" {
+		return nil, "", nil
+	}
+
+	m, err := manifest.Read(s.manifestPath())
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("read previous manifest: %w", err)
+	}
+
+	files := make(map[string]manifest.File, len(m.Files))
+	for _, file := range m.Files {
+		files[file.Path] = file
+	}
+	return files, m.Config, nil
+}
+
+// configHash returns a summary of the site's configuration, whether
+// it came from the command line or from the config file, that changes
+// if any of the options that affect the contents of generated files
+// do, or if the version of bog does. Options that only affect how the
+// build runs or what it reports, such as -jobs or -verbose, are left
+// out so that changing them doesn't cause a full rebuild.
+func (s *Site) configHash() string {
+	f := s.flags
+	f.Incremental = false
+	f.KeepGoing = false
+	f.Jobs = 0
+	f.Serial = false
+	f.Verbose = false
+	f.Quiet = false
+	f.ErrorFormat = ""
+	f.CheckLinks = false
+	f.Force = false
+	f.Clean = false
+	f.Serve = ""
+	f.Version = false
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		panic(fmt.Errorf("encode flags: %w", err))
+	}
+	hash := sha256.Sum256(append(data, version()...))
+	return hex.EncodeToString(hash[:])
+}
+
+// pageDeps returns a summary of the other pages that the output of
+// page in the given format depends on, which changes if any of them
+// do, or an empty string if it doesn't depend on any. The output
+// depends on the targets of refs in the page's content and template,
+// on the pages whose content the template embeds with content, on
+// the page's neighbors if the template uses .Prev or .Next, and on
+// every listed page if it uses .Pages. Each page is summarized by its
+// source, its modification time, and its output, so that changes to
+// its metadata, to which pages are listed, and to their order are all
+// noticed.
+func (s *Site) pageDeps(page *PageInfo, format string) string {
+	uses := templateUsesOf(s.pageTemplate(page, format))
+
+	var sb strings.Builder
+	summarize := func(kind string, p *PageInfo) {
+		if p == nil {
+			fmt.Fprintf(&sb, "%v\n", kind)
+			return
+		}
+		fmt.Fprintf(&sb, "%v\t%v\t%v\t%v\n", kind, p.Path, p.InputInfo.ModTime().UnixNano(), p.OutputFormat(p.Outputs()[0]))
+	}
+
+	refs := uses.refs
+	for _, m := range refPattern.FindAllStringSubmatch(page.ContentAs(format), -1) {
+		refs = append(refs, m[1])
+	}
+	sort.Strings(refs)
+	for _, rel := range refs {
+		summarize("ref", s.bySource[rel])
+	}
+
+	contents := append([]string(nil), uses.contents...)
+	sort.Strings(contents)
+	for _, id := range contents {
+		summarize("content", s.byID[id])
+	}
+
+	if uses.neighbors {
+		summarize("prev", page.Prev())
+		summarize("next", page.Next())
+	}
+	if uses.pages {
+		for _, p := range s.listed {
+			summarize("page", p)
+		}
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+// templateUses describes the parts of the data given to page templates
+// that make the output of a page depend on other pages.
+type templateUses struct {
+	// pages is true if the template uses .Pages.
+	pages bool
+
+	// neighbors is true if the template uses .Prev or .Next.
+	neighbors bool
+
+	// refs are the arguments of calls to ref with constant strings.
+	refs []string
+
+	// contents are the arguments of calls to content with constant
+	// strings.
+	contents []string
+}
+
+// templateUsesOf determines which parts of the page data tmpl and the
+// templates associated with it use. Any field named Pages, Prev, or
+// Next counts, no matter what it's a field of, so the result errs on
+// the side of finding more dependencies than there are.
+func templateUsesOf(tmpl *template.Template) (uses templateUses) {
+	var walk func(node parse.Node)
+	walkList := func(list *parse.ListNode) {
+		if list != nil {
+			walk(list)
+		}
+	}
+	idents := func(idents []string) {
+		for _, ident := range idents {
+			switch ident {
+			case "Pages":
+				uses.pages = true
+			case "Prev", "Next":
+				uses.neighbors = true
+			}
+		}
+	}
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			for _, n := range node.Nodes {
+				walk(n)
+			}
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.IfNode:
+			walk(node.Pipe)
+			walkList(node.List)
+			walkList(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.Pipe)
+			walkList(node.List)
+			walkList(node.ElseList)
+		case *parse.WithNode:
+			walk(node.Pipe)
+			walkList(node.List)
+			walkList(node.ElseList)
+		case *parse.TemplateNode:
+			if node.Pipe != nil {
+				walk(node.Pipe)
+			}
+		case *parse.PipeNode:
+			for _, cmd := range node.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			if len(node.Args) == 2 {
+				fn, ok1 := node.Args[0].(*parse.IdentifierNode)
+				arg, ok2 := node.Args[1].(*parse.StringNode)
+				if ok1 && ok2 {
+					switch fn.Ident {
+					case "ref":
+						uses.refs = append(uses.refs, path.Clean("/" + arg.Text)[1:])
+					case "content":
+						uses.contents = append(uses.contents, arg.Text)
+					}
+				}
+			}
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			idents(node.Ident)
+		case *parse.VariableNode:
+			idents(node.Ident)
+		case *parse.ChainNode:
+			walk(node.Node)
+			idents(node.Field)
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	return uses
+}
+
+// keepFile records the existing file described by o as one of the
+// site's outputs without regenerating it.
+func (s *Site) keepFile(o output) error {
+	content, err := ioutil.ReadFile(o.Path)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(content)
+	o.Hash = hex.EncodeToString(hash[:])
+	s.addOutput(o)
+
+	return nil
+}
@@ -6,6 +6,13 @@ import (
 	"sync"
 )
 
+// MaxSize is the largest capacity, in bytes, of a buffer that Put
+// will return to the pool. Larger buffers are left for the garbage
+// collector so that a single large file doesn't keep a huge buffer
+// around for the life of the process. A value of zero or less disables
+// the limit.
+var MaxSize = 1 << 20
+
 var bufPool = sync.Pool{
 	New: func() interface{} {
 		return new(bytes.Buffer)
@@ -17,8 +24,17 @@ func Get() *bytes.Buffer {
 	return bufPool.Get().(*bytes.Buffer)
 }
 
-// Put resets a buffer and places it into the pool.
+// Put resets a buffer and places it into the pool, unless its capacity
+// is greater than MaxSize, in which case it is discarded. A nil buffer
+// is ignored.
 func Put(buf *bytes.Buffer) {
+	if buf == nil {
+		return
+	}
+	if (MaxSize > 0) && (buf.Cap() > MaxSize) {
+		return
+	}
+
 	buf.Reset()
 	bufPool.Put(buf)
 }
@@ -0,0 +1,66 @@
+package bufpool
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+)
+
+func TestPutNil(t *testing.T) {
+	Put(nil)
+}
+
+func TestPutOversized(t *testing.T) {
+	defer func(max int) { MaxSize = max }(MaxSize)
+	MaxSize = 16
+
+	buf := Get()
+	buf.Write(make([]byte, 32))
+	Put(buf)
+
+	for i := 0; i < 100; i++ {
+		if Get().Cap() > MaxSize {
+			t.Fatal("got an oversized buffer back from the pool")
+		}
+	}
+}
+
+// BenchmarkOversized simulates processing one huge file among many
+// small ones and reports the heap in use afterwards, with and without
+// the size limit.
+func BenchmarkOversized(b *testing.B) {
+	small := bytes.Repeat([]byte("x"), 4<<10)
+	huge := bytes.Repeat([]byte("x"), 16<<20)
+
+	run := func(b *testing.B, max int) {
+		defer func(max int) { MaxSize = max }(MaxSize)
+		MaxSize = max
+
+		b.ReportAllocs()
+		var heap uint64
+		for i := 0; i < b.N; i++ {
+			buf := Get()
+			buf.Write(huge)
+			Put(buf)
+
+			for j := 0; j < 100; j++ {
+				buf := Get()
+				buf.Write(small)
+				Put(buf)
+			}
+
+			// Hold on to a buffer from the pool so that the measurement
+			// includes what it keeps alive.
+			held := Get()
+			runtime.GC()
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			heap += stats.HeapInuse
+			Put(held)
+		}
+		b.ReportMetric(float64(heap)/float64(b.N), "heap-bytes/op")
+	}
+
+	b.Run("limited", func(b *testing.B) { run(b, 1<<20) })
+	b.Run("unlimited", func(b *testing.B) { run(b, 0) })
+}
@@ -5,18 +5,21 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	boolType    = reflect.TypeOf((*bool)(nil))
-	float64Type = reflect.TypeOf((*float64)(nil))
-	intType     = reflect.TypeOf((*int)(nil))
-	int64Type   = reflect.TypeOf((*int64)(nil))
-	stringType  = reflect.TypeOf((*string)(nil))
-	uintType    = reflect.TypeOf((*uint)(nil))
-	uint64Type  = reflect.TypeOf((*uint64)(nil))
+	boolType     = reflect.TypeOf((*bool)(nil))
+	durationType = reflect.TypeOf((*time.Duration)(nil))
+	float64Type  = reflect.TypeOf((*float64)(nil))
+	intType      = reflect.TypeOf((*int)(nil))
+	int64Type    = reflect.TypeOf((*int64)(nil))
+	stringType   = reflect.TypeOf((*string)(nil))
+	uintType     = reflect.TypeOf((*uint)(nil))
+	uint64Type   = reflect.TypeOf((*uint64)(nil))
 )
 
 // ParseFlags parses flags into the given struct using a very simple
@@ -28,9 +31,16 @@ var (
 //
 // If the field is of a kind corresponding to the various typed
 // parsing functions in the flag package, such as float64, string, or
-// int, the appropriate function is called to parse it.
+// int, the appropriate function is called to parse it. Fields of type
+// time.Duration are parsed with time.ParseDuration rather than as
+// integers.
 //
-// In either of these two cases, the arguments passed to the parsing
+// If the field is a []string or an []int, a flag is registered that
+// can be given more than once, each time with a comma-separated list
+// of values that are appended to it. The default, if any, is a
+// space-separated list, which the first use of the flag replaces.
+//
+// In any of these cases, the arguments passed to the parsing
 // function for that field are set via a comma separated list in the
 // "flag" tag. There are a few special cases, however:
 //
@@ -38,8 +48,38 @@ var (
 // number, that number is assumed to correspond to the index of an
 // extra argument as returned by flag.Arg(n). An optional second
 // element is used as a default value.
+//
+// A flag field may also have an "env" tag naming an environment
+// variable. If the flag isn't given on the command line but the
+// variable is set, the flag is set from it as though it had been,
+// before any positional arguments are handled.
+//
+// If the first element of the tag is followed by ";required", such as
+// "out;required,,output directory", the flag or positional argument
+// must be given, either explicitly or via its environment variable.
+// If it isn't, fs.Usage is called and an error is returned.
 func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
-	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	_, err := Parse(flags, usage)
+	return err
+}
+
+// Parse is like ParseFlags, but also returns the flag set that the
+// flags were parsed with, which is flag.CommandLine, so that the
+// caller can find out which ones were given, such as with fs.Visit.
+// Like flag.Parse, it shouldn't be called more than once.
+func Parse(flags interface{}, usage func(fs *flag.FlagSet)) (*flag.FlagSet, error) {
+	err := ParseFlagSet(flag.CommandLine, os.Args[1:], flags, usage)
+	if err != nil {
+		return nil, err
+	}
+	return flag.CommandLine, nil
+}
+
+// ParseFlagSet is like ParseFlags, but registers the flags with fs and
+// parses args, which should not include the command name, rather than
+// using the process's command line. This allows, for example, each
+// subcommand of a tool to have its own flags.
+func ParseFlagSet(fs *flag.FlagSet, args []string, flags interface{}, usage func(fs *flag.FlagSet)) error {
 
 	type argFlag struct {
 		field reflect.StructField
@@ -49,10 +89,13 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 		parts []string
 	}
 
+	var required []string
+
 	v := reflect.ValueOf(flags).Elem()
 	t := v.Type()
 
-	args := make([]argFlag, 0, v.NumField())
+	positional := make([]argFlag, 0, v.NumField())
+	envs := make(map[string]string)
 	for i := 0; i < v.NumField(); i++ {
 		field := t.Field(i)
 		if field.PkgPath != "" {
@@ -65,12 +108,16 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 
 		fv := v.Field(i)
 
+		tag, req := cutRequired(tag)
 		parts := strings.SplitN(tag, ",", 2)
 		if len(parts) == 0 {
 			panic(fmt.Errorf("invalid tag on field %q: %q", field.Name, tag))
 		}
+		if req {
+			required = append(required, parts[0])
+		}
 		if n, err := strconv.ParseInt(parts[0], 10, 0); err == nil {
-			args = append(args, argFlag{
+			positional = append(positional, argFlag{
 				field: field,
 				tag:   tag,
 				v:     fv,
@@ -80,6 +127,10 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 			continue
 		}
 
+		if env, ok := field.Tag.Lookup("env"); ok {
+			envs[parts[0]] = env
+		}
+
 		if val, ok := fv.Interface().(flag.Value); ok {
 			fs.Var(val, parts[0], parts[1])
 			continue
@@ -90,6 +141,15 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 		}
 
 		parts = strings.SplitN(tag, ",", 3)
+		if field.Type == durationType.Elem() {
+			d, err := time.ParseDuration(parts[1])
+			if err != nil {
+				panic(fmt.Errorf("parse default from %q for %q: %w", tag, field.Name, err))
+			}
+			fs.DurationVar(fv.Addr().Interface().(*time.Duration), parts[0], d, parts[2])
+			continue
+		}
+
 		switch field.Type.Kind() {
 		case reflect.Bool:
 			d, err := strconv.ParseBool(parts[1])
@@ -136,6 +196,17 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 			}
 			fs.Uint64Var(fv.Addr().Convert(uint64Type).Interface().(*uint64), parts[0], d, parts[2])
 
+		case reflect.Slice:
+			val, ok := newSliceValue(fv)
+			if !ok {
+				panic(fmt.Errorf("unsupported flag type for field %q: %v", field.Name, field.Type))
+			}
+			err := val.setDefault(strings.Fields(parts[1]))
+			if err != nil {
+				panic(fmt.Errorf("parse default from %q for %q: %w", tag, field.Name, err))
+			}
+			fs.Var(val, parts[0], parts[2])
+
 		default:
 			panic(fmt.Errorf("unsupported flag type for field %q: %v", field.Name, field.Type))
 		}
@@ -146,12 +217,23 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 			usage(fs)
 		}
 	}
-	err := fs.Parse(os.Args[1:])
+	err := fs.Parse(args)
 	if err != nil {
 		return fmt.Errorf("parse: %w", err)
 	}
 
-	for _, arg := range args {
+	err = setFromEnv(fs, envs)
+	if err != nil {
+		return err
+	}
+
+	err = checkRequired(fs, required)
+	if err != nil {
+		fs.Usage()
+		return err
+	}
+
+	for _, arg := range positional {
 		raw := fs.Arg(arg.n)
 
 		if val, ok := arg.v.Interface().(flag.Value); ok {
@@ -169,6 +251,27 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 			continue
 		}
 
+		if arg.field.Type == durationType.Elem() {
+			if raw == "" {
+				if len(arg.parts) < 2 {
+					return fmt.Errorf("invalid value for arg %q: %q", arg.field.Name, raw)
+				}
+				d, err := time.ParseDuration(arg.parts[1])
+				if err != nil {
+					panic(fmt.Errorf("parse default from %q for %q: %w", arg.tag, arg.field.Name, err))
+				}
+				arg.v.SetInt(int64(d))
+				continue
+			}
+
+			v, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("invalid value for arg %q: %w", arg.field.Name, err)
+			}
+			arg.v.SetInt(int64(v))
+			continue
+		}
+
 		switch arg.field.Type.Kind() {
 		case reflect.Bool:
 			v, err := strconv.ParseBool(raw)
@@ -243,6 +346,27 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 			}
 			arg.v.SetUint(d)
 
+		case reflect.Slice:
+			val, ok := newSliceValue(arg.v)
+			if !ok {
+				panic(fmt.Errorf("unsupported flag type for field %q: %v", arg.field.Name, arg.field.Type))
+			}
+			if raw == "" {
+				var d []string
+				if len(arg.parts) > 1 {
+					d = strings.Fields(arg.parts[1])
+				}
+				err := val.setDefault(d)
+				if err != nil {
+					panic(fmt.Errorf("parse default from %q for %q: %w", arg.tag, arg.field.Name, err))
+				}
+				continue
+			}
+			err := val.Set(raw)
+			if err != nil {
+				return fmt.Errorf("set arg %q: %w", arg.field.Name, err)
+			}
+
 		default:
 			panic(fmt.Errorf("unsupported flag type for field %q: %v", arg.field.Name, arg.field.Type))
 		}
@@ -250,3 +374,153 @@ func ParseFlags(flags interface{}, usage func(fs *flag.FlagSet)) error {
 
 	return nil
 }
+
+// cutRequired removes the ";required" marker from the first element of
+// tag, if it has one, and reports whether it did.
+func cutRequired(tag string) (string, bool) {
+	parts := strings.SplitN(tag, ",", 2)
+	if !strings.HasSuffix(parts[0], ";required") {
+		return tag, false
+	}
+
+	parts[0] = strings.TrimSuffix(parts[0], ";required")
+	return strings.Join(parts, ","), true
+}
+
+// checkRequired returns an error naming any of the required flags that
+// weren't given. Positional arguments are given by their index.
+func checkRequired(fs *flag.FlagSet, required []string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var missing []string
+	for _, name := range required {
+		if n, err := strconv.ParseInt(name, 10, 0); err == nil {
+			if int(n) >= fs.NArg() {
+				missing = append(missing, fmt.Sprintf("argument %v", n))
+			}
+			continue
+		}
+
+		if !given[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("missing required %v", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// setFromEnv sets each flag in fs that wasn't given on the command
+// line from the environment variable that envs maps its name to, if
+// that variable is set.
+func setFromEnv(fs *flag.FlagSet, envs map[string]string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if given[name] {
+			continue
+		}
+		raw, ok := os.LookupEnv(envs[name])
+		if !ok {
+			continue
+		}
+
+		err := fs.Set(name, raw)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for $%v: %w", raw, envs[name], err)
+		}
+	}
+
+	return nil
+}
+
+// sliceValue is a flag.Value for a slice field. Each call to Set
+// appends the comma-separated values given to it, except for the
+// first, which replaces the default.
+type sliceValue struct {
+	v     reflect.Value
+	parse func(string) (reflect.Value, error)
+	set   bool
+}
+
+// newSliceValue returns a sliceValue for v, which must be a settable
+// slice. If v's element type isn't supported, ok is false.
+func newSliceValue(v reflect.Value) (val *sliceValue, ok bool) {
+	var parse func(string) (reflect.Value, error)
+	switch v.Type().Elem().Kind() {
+	case reflect.String:
+		parse = func(str string) (reflect.Value, error) {
+			return reflect.ValueOf(str), nil
+		}
+
+	case reflect.Int:
+		parse = func(str string) (reflect.Value, error) {
+			n, err := strconv.ParseInt(str, 10, 0)
+			return reflect.ValueOf(int(n)), err
+		}
+
+	default:
+		return nil, false
+	}
+
+	return &sliceValue{v: v, parse: parse}, true
+}
+
+// setDefault sets the slice to the given values without marking it as
+// having been set.
+func (val *sliceValue) setDefault(values []string) error {
+	s := reflect.MakeSlice(val.v.Type(), 0, len(values))
+	for _, str := range values {
+		e, err := val.parse(str)
+		if err != nil {
+			return err
+		}
+		s = reflect.Append(s, e.Convert(val.v.Type().Elem()))
+	}
+	val.v.Set(s)
+	return nil
+}
+
+func (val *sliceValue) String() string {
+	if !val.v.IsValid() {
+		return ""
+	}
+
+	strs := make([]string, 0, val.v.Len())
+	for i := 0; i < val.v.Len(); i++ {
+		strs = append(strs, fmt.Sprint(val.v.Index(i).Interface()))
+	}
+	return strings.Join(strs, ",")
+}
+
+func (val *sliceValue) Set(str string) error {
+	s := val.v
+	if !val.set {
+		s = reflect.MakeSlice(val.v.Type(), 0, 0)
+		val.set = true
+	}
+
+	for _, part := range strings.Split(str, ",") {
+		e, err := val.parse(part)
+		if err != nil {
+			return err
+		}
+		s = reflect.Append(s, e.Convert(val.v.Type().Elem()))
+	}
+	val.v.Set(s)
+	return nil
+}
@@ -0,0 +1,131 @@
+package cli_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeedleFake/bog/internal/cli"
+)
+
+// parse parses args into flags with a new flag set that doesn't print
+// anything.
+func parse(flags interface{}, args ...string) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return cli.ParseFlagSet(fs, args, flags, nil)
+}
+
+type durationFlags struct {
+	Timeout time.Duration `flag:"timeout,5s,how long to wait"`
+	Delay   time.Duration `flag:"0,1m"`
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		args     []string
+		timeout  time.Duration
+		delay    time.Duration
+		errorful bool
+	}{
+		{args: nil, timeout: 5 * time.Second, delay: time.Minute},
+		{args: []string{"-timeout", "100ms"}, timeout: 100 * time.Millisecond, delay: time.Minute},
+		{args: []string{"-timeout", "1h30m", "100ms"}, timeout: 90 * time.Minute, delay: 100 * time.Millisecond},
+		{args: []string{"1h30m"}, timeout: 5 * time.Second, delay: 90 * time.Minute},
+		{args: []string{"-timeout", "soon"}, errorful: true},
+		{args: []string{"soon"}, errorful: true},
+	}
+
+	for _, test := range tests {
+		var flags durationFlags
+		err := parse(&flags, test.args...)
+		if test.errorful {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.args)
+				continue
+			}
+			if !strings.Contains(err.Error(), `"soon"`) {
+				t.Errorf("%q: error doesn't mention the invalid duration: %v", test.args, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+
+		if flags.Timeout != test.timeout {
+			t.Errorf("%q: timeout is %v, not %v", test.args, flags.Timeout, test.timeout)
+		}
+		if flags.Delay != test.delay {
+			t.Errorf("%q: delay is %v, not %v", test.args, flags.Delay, test.delay)
+		}
+	}
+}
+
+type setFlags struct {
+	Name    string   `flag:"name;required,,name of the thing"`
+	Verbose bool     `flag:"v,false,be verbose"`
+	Tags    []string `flag:"tags,a b,tags to apply"`
+	Source  string   `flag:"0,."`
+}
+
+func TestParseFlagSet(t *testing.T) {
+	var f1, f2 setFlags
+	err := parse(&f1, "-name", "one", "-tags", "x,y", "-tags", "z", "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parse(&f2, "-v", "-name", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want1 := setFlags{Name: "one", Tags: []string{"x", "y", "z"}, Source: "src"}
+	want2 := setFlags{Name: "two", Verbose: true, Tags: []string{"a", "b"}, Source: "."}
+	if !reflect.DeepEqual(f1, want1) {
+		t.Errorf("got %#v, want %#v", f1, want1)
+	}
+	if !reflect.DeepEqual(f2, want2) {
+		t.Errorf("got %#v, want %#v", f2, want2)
+	}
+
+	var f3 setFlags
+	err = parse(&f3, "-v")
+	if (err == nil) || !strings.Contains(err.Error(), "-name") {
+		t.Errorf("expected an error about the missing -name, got %v", err)
+	}
+}
+
+func TestParseCommandLine(t *testing.T) {
+	defer func(fs *flag.FlagSet, args []string) {
+		flag.CommandLine, os.Args = fs, args
+	}(flag.CommandLine, os.Args)
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	os.Args = []string{"test", "-global", "yes", "-name", "cmd", "src"}
+
+	global := flag.String("global", "no", "a flag registered elsewhere")
+
+	var flags setFlags
+	fs, err := cli.Parse(&flags, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fs != flag.CommandLine {
+		t.Errorf("didn't use flag.CommandLine")
+	}
+	if !flag.Parsed() {
+		t.Errorf("flag.Parsed is false")
+	}
+	if *global != "yes" {
+		t.Errorf("global flag is %q, not %q", *global, "yes")
+	}
+	if (flags.Name != "cmd") || (flags.Source != "src") {
+		t.Errorf("got %#v", flags)
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"os/signal"
 )
 
+// SignalContext returns a child of ctx that is canceled when the
+// process receives one of the given signals. After the first signal,
+// the signals are reset to their default behavior, so a second one
+// will, for example, kill a process that hangs while shutting down.
 func SignalContext(ctx context.Context, signals ...os.Signal) context.Context {
 	ctx, cancel := context.WithCancel(ctx)
 	go func() {
@@ -13,9 +17,13 @@ func SignalContext(ctx context.Context, signals ...os.Signal) context.Context {
 
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, signals...)
+		defer signal.Reset(signals...)
 		defer signal.Stop(c)
 
-		<-c
+		select {
+		case <-c:
+		case <-ctx.Done():
+		}
 	}()
 
 	return ctx
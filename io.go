@@ -2,16 +2,21 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/DeedleFake/bog/internal/bufpool"
+	"github.com/pelletier/go-toml"
 	"gopkg.in/yaml.v2"
 )
 
 // readFile reads a file into buffer that is retrieved from the buffer
-// pool.
+// pool. If it fails, the buffer is put back and nil is returned.
 func readFile(path string) (*bytes.Buffer, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -21,10 +26,15 @@ func readFile(path string) (*bytes.Buffer, error) {
 
 	buf := bufpool.Get()
 	_, err = io.Copy(buf, file)
-	return buf, err
+	if err != nil {
+		bufpool.Put(buf)
+		return nil, err
+	}
+	return buf, nil
 }
 
-// readYAMLFile parses YAML data from the file at path.
+// readYAMLFile parses YAML data from the file at path. An empty file
+// results in a nil value.
 func readYAMLFile(path string) (v interface{}, err error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -33,18 +43,75 @@ func readYAMLFile(path string) (v interface{}, err error) {
 	defer file.Close()
 
 	err = yaml.NewDecoder(file).Decode(&v)
+	if (err != nil) && (err != io.EOF) {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return v, nil
+}
+
+// readJSONFile parses JSON data from the file at path. Numbers are
+// decoded as json.Numbers so that integers can be told apart from
+// floats. An empty file results in a nil value.
+func readJSONFile(path string) (v interface{}, err error) {
+	file, err := os.Open(path)
 	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	d := json.NewDecoder(file)
+	d.UseNumber()
+	err = d.Decode(&v)
+	if (err != nil) && (err != io.EOF) {
 		return nil, fmt.Errorf("decode: %w", err)
 	}
 	return v, nil
 }
 
-// fileExists returns true if the file exists.
-func fileExists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	ok := !os.IsNotExist(err)
-	if ok && (err != nil) {
-		return ok, err
+// readTOMLFile parses TOML data from the file at path.
+func readTOMLFile(path string) (interface{}, error) {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return fromTOML(tree.ToMap()), nil
+}
+
+// copyFile copies the file at src to dst byte for byte, creating any
+// necessary parent directories and giving dst the same permissions
+// and modification time as src. It returns the hex-encoded SHA-256
+// hash of the copied contents.
+func copyFile(dst, src string, info os.FileInfo) (hash string, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if err != nil {
+		out.Close()
+		return "", err
+	}
+	err = out.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Chtimes(dst, info.ModTime(), info.ModTime())
+	if err != nil {
+		return "", err
 	}
-	return ok, nil
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
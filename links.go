@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// linkAttrs are the attributes that are checked for links by
+// -checklinks.
+var linkAttrs = map[string]bool{
+	"href": true,
+	"src":  true,
+}
+
+// htmlDoc is the information about a generated HTML file needed to
+// check links to and from it.
+type htmlDoc struct {
+	// Links are the values of the link attributes in the file, in
+	// order.
+	Links []string
+
+	// IDs are the IDs of the elements in the file, which links can
+	// refer to with fragments.
+	IDs map[string]bool
+}
+
+// readHTMLDoc parses the HTML file at path.
+func readHTMLDoc(path string) (*htmlDoc, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	root, err := html.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	doc := htmlDoc{IDs: make(map[string]bool)}
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			for _, attr := range node.Attr {
+				switch {
+				case linkAttrs[attr.Key]:
+					doc.Links = append(doc.Links, attr.Val)
+				case attr.Key == "id":
+					doc.IDs[attr.Val] = true
+				case (attr.Key == "name") && (node.Data == "a"):
+					doc.IDs[attr.Val] = true
+				}
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	return &doc, nil
+}
+
+// isHTML returns true if the file at path is an HTML file, going by
+// its extension.
+func isHTML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return true
+	default:
+		return false
+	}
+}
+
+// checkLinks checks the relative links in the generated HTML files,
+// returning an error for each one that refers to a file that isn't in
+// the output directory or to a fragment that isn't the ID of an
+// element in the HTML file that it refers to. Links with a scheme or
+// a host and links starting with "/" aren't checked.
+func (s *Site) checkLinks() []error {
+	docs := make(map[string]*htmlDoc)
+	getDoc := func(path string) (*htmlDoc, error) {
+		if doc, ok := docs[path]; ok {
+			return doc, nil
+		}
+		doc, err := readHTMLDoc(path)
+		if err != nil {
+			return nil, err
+		}
+		docs[path] = doc
+		return doc, nil
+	}
+
+	var paths []string
+	for _, o := range s.outputs {
+		if o.Page && isHTML(o.Path) {
+			paths = append(paths, o.Path)
+		}
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for _, path := range paths {
+		doc, err := getDoc(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("check links in %q: %w", path, err))
+			continue
+		}
+
+		for _, link := range doc.Links {
+			err := s.checkLink(path, link, getDoc)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("broken link %q in %q: %w", link, path, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+// checkLink checks a single link found in the HTML file at path.
+func (s *Site) checkLink(path, link string, getDoc func(string) (*htmlDoc, error)) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "") || (u.Host != "") || strings.HasPrefix(u.Path, "/") {
+		return nil
+	}
+
+	target := path
+	if u.Path != "" {
+		target = filepath.Join(filepath.Dir(path), filepath.FromSlash(u.Path))
+		info, err := os.Stat(target)
+		if err != nil {
+			return fmt.Errorf("no such file")
+		}
+		if info.IsDir() {
+			target = filepath.Join(target, "index.html")
+			if _, err := os.Stat(target); err != nil {
+				return fmt.Errorf("no index in directory")
+			}
+		}
+	}
+
+	if (u.Fragment == "") || !isHTML(target) {
+		return nil
+	}
+	doc, err := getDoc(target)
+	if err != nil {
+		return err
+	}
+	if !doc.IDs[u.Fragment] {
+		return fmt.Errorf("no element with ID %q", u.Fragment)
+	}
+	return nil
+}
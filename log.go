@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// logLevel controls how much output bog produces.
+type logLevel int
+
+const (
+	// levelQuiet only shows errors.
+	levelQuiet logLevel = iota
+
+	// levelNormal also shows warnings and a line for each file that is
+	// generated, copied, skipped, or removed.
+	levelNormal
+
+	// levelVerbose also shows timing information and the reasons for
+	// decisions such as regenerating a file.
+	levelVerbose
+)
+
+// The logger's state. It is set up by main before anything is logged
+// and not changed afterwards.
+var (
+	logLvl            = levelNormal
+	logOut  io.Writer = os.Stdout
+	logErrs io.Writer = os.Stderr
+)
+
+// infof prints a formatted line of progress output unless -quiet was
+// given.
+func infof(format string, args ...interface{}) {
+	if logLvl >= levelNormal {
+		fmt.Fprintf(logOut, format+"\n", args...)
+	}
+}
+
+// debugf prints a formatted line of detailed output if -verbose was
+// given.
+func debugf(format string, args ...interface{}) {
+	if logLvl >= levelVerbose {
+		fmt.Fprintf(logOut, format+"\n", args...)
+	}
+}
+
+// statusf prints a formatted status line to stderr, keeping it apart
+// from the per-file progress output, unless -quiet was given.
+func statusf(format string, args ...interface{}) {
+	if logLvl >= levelNormal {
+		fmt.Fprintf(logErrs, format+"\n", args...)
+	}
+}
+
+// warnf prints a formatted warning to stderr unless -quiet was given.
+func warnf(format string, args ...interface{}) {
+	if logLvl >= levelNormal {
+		fmt.Fprintf(logErrs, "Warning: "+format+"\n", args...)
+	}
+}
+
+// errorf prints a formatted error to stderr.
+func errorf(format string, args ...interface{}) {
+	fmt.Fprintf(logErrs, "Error: "+format+"\n", args...)
+}
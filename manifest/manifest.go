@@ -0,0 +1,125 @@
+// Package manifest provides a record of the files generated by a
+// build, which can be used by later builds and by other tools to
+// determine what was generated and from what.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultPath is the conventional path of a manifest relative to the
+// output directory of a build.
+const DefaultPath = ".bog/manifest.json"
+
+// Manifest is a record of the files generated by a build.
+type Manifest struct {
+	// Built is the time at which the build finished.
+	Built time.Time `json:"built"`
+
+	// Config is an opaque summary of the configuration of the build
+	// that affects the contents of the files that it generated, which
+	// changes when that configuration does.
+	Config string `json:"config,omitempty"`
+
+	// Files are the generated files, sorted by path.
+	Files []File `json:"files"`
+}
+
+// File is a single generated file in a manifest.
+type File struct {
+	// Path is the slash-separated path of the file relative to the
+	// output directory.
+	Path string `json:"path"`
+
+	// Sources are the paths of the files from which the file was
+	// generated, if any.
+	Sources []string `json:"sources,omitempty"`
+
+	// Hash is the hex-encoded SHA-256 hash of the file's contents.
+	Hash string `json:"hash"`
+
+	// ModTime is the time at which the file's contents were last
+	// changed, as best as can be determined from its sources.
+	ModTime time.Time `json:"modtime"`
+
+	// Deps is an opaque summary of the other pages that the file's
+	// contents depend on, such as its neighbors, which changes when
+	// they do. It is empty if the file doesn't depend on any.
+	Deps string `json:"deps,omitempty"`
+}
+
+// Read reads a manifest from the file at path.
+func Read(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return &m, nil
+}
+
+// Write writes the manifest to the file at path, creating any
+// necessary parent directories. The write is atomic in that the
+// manifest is written to a temporary file in the same directory which
+// is then renamed to path, so readers never see a partially written
+// manifest.
+func (m *Manifest) Write(path string) (err error) {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Lookup returns the file in the manifest with the given
+// slash-separated path.
+func (m *Manifest) Lookup(path string) (File, bool) {
+	for _, file := range m.Files {
+		if file.Path == path {
+			return file, true
+		}
+	}
+	return File{}, false
+}
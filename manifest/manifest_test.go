@@ -0,0 +1,45 @@
+package manifest_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DeedleFake/bog/manifest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	built := time.Date(2020, 6, 1, 12, 30, 0, 0, time.UTC)
+	m := &manifest.Manifest{
+		Built: built,
+		Files: []manifest.File{
+			{Path: "posts/b.html", Sources: []string{"posts/b.md"}, Hash: "bb", ModTime: built.Add(-time.Hour)},
+			{Path: "a.css", Hash: "aa", ModTime: built.Add(-2 * time.Hour)},
+			{Path: "index.html", Sources: []string{"index.tmpl", "posts/b.md"}, Hash: "cc", ModTime: built},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), ".bog", "manifest.json")
+	err := m.Write(path)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got, err := manifest.Read(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("got %#v\nwant %#v", got, m)
+	}
+
+	for i, name := range []string{"a.css", "index.html", "posts/b.html"} {
+		if got.Files[i].Path != name {
+			t.Errorf("file %v is %q, not %q", i, got.Files[i].Path, name)
+		}
+	}
+	if file, ok := got.Lookup("index.html"); !ok || (file.Hash != "cc") {
+		t.Errorf("lookup: got %#v, %v", file, ok)
+	}
+}
@@ -0,0 +1,25 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// AnchorRenderer is a renderer that adds a link to each heading that
+// has an ID, pointing at the heading itself, so that readers can
+// easily get a link to a specific section of a page. The link has the
+// class "anchor" so that it can be styled.
+type AnchorRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r *AnchorRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if (node.Type == blackfriday.Heading) && !entering && (node.HeadingID != "") {
+		fmt.Fprintf(w, ` <a class="anchor" href="#%v" aria-hidden="true">¶</a>`, html.EscapeString(node.HeadingID))
+	}
+
+	return r.Renderer.RenderNode(w, node, entering)
+}
@@ -0,0 +1,190 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// gemLink is a link that has been found inside of a block and that
+// will be written as a link line after it.
+type gemLink struct {
+	dest  string
+	title string
+}
+
+// GemtextRenderer is a blackfriday.Renderer that renders markdown as
+// gemtext, the markup format used by Gemini. Gemtext only supports
+// links on their own lines, so links found inside of paragraphs, list
+// items, and so on are listed after the block that they're found in.
+// Formatting that gemtext has no equivalent for, such as emphasis, is
+// dropped, leaving just the text.
+type GemtextRenderer struct {
+	links []gemLink
+	link  *gemLink
+	text  bytes.Buffer
+}
+
+// NewGemtextRenderer returns a new GemtextRenderer.
+func NewGemtextRenderer() *GemtextRenderer {
+	return new(GemtextRenderer)
+}
+
+func (r *GemtextRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Heading:
+		if entering {
+			level := node.Level
+			if level > 3 {
+				level = 3
+			}
+			io.WriteString(w, strings.Repeat("#", level)+" ")
+			return blackfriday.GoToNext
+		}
+		io.WriteString(w, "\n")
+		r.flushLinks(w)
+		io.WriteString(w, "\n")
+
+	case blackfriday.Paragraph:
+		if entering {
+			if isIn(node, blackfriday.BlockQuote) {
+				io.WriteString(w, "> ")
+			}
+			return blackfriday.GoToNext
+		}
+		io.WriteString(w, "\n")
+		if !isIn(node, blackfriday.Item) {
+			r.flushLinks(w)
+			io.WriteString(w, "\n")
+		}
+
+	case blackfriday.Item:
+		if entering {
+			io.WriteString(w, "* ")
+			return blackfriday.GoToNext
+		}
+
+	case blackfriday.List:
+		if !entering && !isIn(node, blackfriday.Item) {
+			r.flushLinks(w)
+			io.WriteString(w, "\n")
+		}
+
+	case blackfriday.CodeBlock:
+		fmt.Fprintf(w, "```%s\n", node.Info)
+		w.Write(node.Literal)
+		if !bytes.HasSuffix(node.Literal, []byte("\n")) {
+			io.WriteString(w, "\n")
+		}
+		io.WriteString(w, "```\n\n")
+
+	case blackfriday.Link, blackfriday.Image:
+		if entering {
+			r.link = &gemLink{dest: string(node.LinkData.Destination)}
+			r.text.Reset()
+			return blackfriday.GoToNext
+		}
+		r.link.title = r.text.String()
+		r.links = append(r.links, *r.link)
+		r.link = nil
+
+	case blackfriday.Text, blackfriday.Code:
+		text := bytes.ReplaceAll(node.Literal, []byte("\n"), []byte(" "))
+		if spaceAfterHTML(node) {
+			text = bytes.TrimRight(text, " ")
+		}
+		if r.link != nil {
+			r.text.Write(text)
+			if node.Parent.Type == blackfriday.Image {
+				return blackfriday.GoToNext
+			}
+		}
+		w.Write(text)
+
+	case blackfriday.Hardbreak:
+		io.WriteString(w, "\n")
+
+	case blackfriday.Softbreak:
+		io.WriteString(w, " ")
+
+	case blackfriday.HorizontalRule:
+		io.WriteString(w, "---\n\n")
+
+	case blackfriday.TableCell:
+		if entering && (node.Prev != nil) {
+			io.WriteString(w, " | ")
+		}
+
+	case blackfriday.TableRow:
+		if !entering {
+			io.WriteString(w, "\n")
+		}
+
+	case blackfriday.Table:
+		if !entering {
+			r.flushLinks(w)
+			io.WriteString(w, "\n")
+		}
+
+	case blackfriday.HTMLBlock, blackfriday.HTMLSpan:
+		// Raw HTML has no meaning in gemtext.
+	}
+
+	return blackfriday.GoToNext
+}
+
+// flushLinks writes any pending links as link lines.
+func (r *GemtextRenderer) flushLinks(w io.Writer) {
+	for _, link := range r.links {
+		if link.title == "" {
+			fmt.Fprintf(w, "=> %v\n", link.dest)
+			continue
+		}
+		fmt.Fprintf(w, "=> %v %v\n", link.dest, link.title)
+	}
+	r.links = r.links[:0]
+}
+
+func (r *GemtextRenderer) RenderHeader(w io.Writer, ast *blackfriday.Node) {}
+
+func (r *GemtextRenderer) RenderFooter(w io.Writer, ast *blackfriday.Node) {
+	r.flushLinks(w)
+}
+
+// spaceAfterHTML returns true if node is followed by inline HTML,
+// which is dropped, and then by either the end of the line or by more
+// whitespace. In that case, any trailing whitespace in node would be
+// left dangling or doubled up, so it should be trimmed.
+func spaceAfterHTML(node *blackfriday.Node) bool {
+	next := node.Next
+	if (next == nil) || (next.Type != blackfriday.HTMLSpan) {
+		return false
+	}
+	for (next != nil) && (next.Type == blackfriday.HTMLSpan) {
+		next = next.Next
+	}
+
+	switch {
+	case next == nil:
+		return true
+	case (next.Type == blackfriday.Softbreak) || (next.Type == blackfriday.Hardbreak):
+		return true
+	case next.Type == blackfriday.Text:
+		return bytes.HasPrefix(next.Literal, []byte(" ")) || bytes.HasPrefix(next.Literal, []byte("\n"))
+	default:
+		return false
+	}
+}
+
+// isIn returns true if any of node's ancestors are of type t.
+func isIn(node *blackfriday.Node, t blackfriday.NodeType) bool {
+	for node := node.Parent; node != nil; node = node.Parent {
+		if node.Type == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package markdown
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+func TestGemtextRenderer(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Headings",
+			src:  "# One\n\n## Two\n\n#### Four\n",
+			want: "# One\n\n## Two\n\n### Four\n\n",
+		},
+		{
+			name: "Paragraph",
+			src:  "Some *emphasized*\ntext.\n",
+			want: "Some emphasized text.\n\n",
+		},
+		{
+			name: "List",
+			src:  "* One\n* Two\n",
+			want: "* One\n* Two\n\n",
+		},
+		{
+			name: "TaskList",
+			src:  "* [ ] Todo\n* [x] Done\n",
+			want: "* [ ] Todo\n* [x] Done\n\n",
+		},
+		{
+			name: "FencedCode",
+			src:  "```go\nfmt.Println(\"Hello\")\n```\n",
+			want: "```go\nfmt.Println(\"Hello\")\n```\n\n",
+		},
+		{
+			name: "Links",
+			src:  "See [one](one.gmi) and [two](https://example.com/two).\n\nAfter.\n",
+			want: "See one and two.\n=> one.gmi one\n=> https://example.com/two two\n\nAfter.\n\n",
+		},
+		{
+			name: "LinksInList",
+			src:  "* A [link](a.gmi)\n* Another [link](b.gmi)\n",
+			want: "* A link\n* Another link\n=> a.gmi link\n=> b.gmi link\n\n",
+		},
+		{
+			name: "LinkInHeading",
+			src:  "# About [me](me.gmi)\n",
+			want: "# About me\n=> me.gmi me\n\n",
+		},
+		{
+			name: "Quote",
+			src:  "> Quoted.\n",
+			want: "> Quoted.\n\n",
+		},
+		{
+			name: "More",
+			src:  "Intro <!-- more -->\n\nRest.\n",
+			want: "Intro\n\nRest.\n\n",
+		},
+		{
+			name: "MoreInline",
+			src:  "Intro <!-- more --> rest.\n",
+			want: "Intro rest.\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions)).Parse([]byte(test.src))
+
+			var buf bytes.Buffer
+			err := Render(&buf, root, NewGemtextRenderer())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, test.want)
+			}
+		})
+	}
+}
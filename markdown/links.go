@@ -0,0 +1,46 @@
+package markdown
+
+import (
+	"io"
+	"net/url"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// linkFlags are the HTML renderer flags that affect the attributes of
+// links.
+const linkFlags = blackfriday.NofollowLinks |
+	blackfriday.NoreferrerLinks |
+	blackfriday.NoopenerLinks |
+	blackfriday.HrefTargetBlank
+
+// ExternalLinkRenderer is an HTML renderer that applies the
+// link-related flags in LinkFlags, such as blackfriday.NoopenerLinks,
+// only to links to external URLs, meaning those with either a scheme
+// or a host. blackfriday's own handling of those flags considers any
+// link that doesn't start with "/", "#", "./", or "../" to be
+// external, including plain relative links such as "post.html".
+type ExternalLinkRenderer struct {
+	*blackfriday.HTMLRenderer
+	LinkFlags blackfriday.HTMLFlags
+}
+
+func (r *ExternalLinkRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if (node.Type == blackfriday.Link) && entering {
+		r.Flags &^= linkFlags
+		if isExternal(node.LinkData.Destination) {
+			r.Flags |= r.LinkFlags & linkFlags
+		}
+	}
+
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// isExternal returns true if dest is a URL with a scheme or a host.
+func isExternal(dest []byte) bool {
+	u, err := url.Parse(string(dest))
+	if err != nil {
+		return false
+	}
+	return (u.Scheme != "") || (u.Host != "")
+}
@@ -0,0 +1,63 @@
+package markdown
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// TaskLists is not a blackfriday extension, but is used alongside
+// them to enable task lists, rendered by TaskListRenderer. Its value
+// doesn't overlap with any of blackfriday's own extensions.
+const TaskLists blackfriday.Extensions = 1 << 30
+
+// TaskListRenderer is an HTML renderer that renders list items that
+// start with "[ ]" or "[x]", as in GitHub's task lists, with a
+// disabled checkbox in place of the brackets, checked in the case of
+// "[x]".
+type TaskListRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r *TaskListRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if !entering || !isTaskText(node) {
+		return r.Renderer.RenderNode(w, node, entering)
+	}
+
+	checked := node.Literal[1] != ' '
+	if checked {
+		io.WriteString(w, `<input type="checkbox" checked="" disabled="" />`)
+	} else {
+		io.WriteString(w, `<input type="checkbox" disabled="" />`)
+	}
+
+	// The brackets are left out of the text by rendering it with them
+	// temporarily removed.
+	literal := node.Literal
+	node.Literal = literal[3:]
+	defer func() { node.Literal = literal }()
+	return r.Renderer.RenderNode(w, node, entering)
+}
+
+// isTaskText returns true if node is the text at the start of a task
+// list item.
+func isTaskText(node *blackfriday.Node) bool {
+	if (node.Type != blackfriday.Text) || (node.Prev != nil) {
+		return false
+	}
+
+	para := node.Parent
+	if (para == nil) || (para.Type != blackfriday.Paragraph) || (para.Prev != nil) {
+		return false
+	}
+	if (para.Parent == nil) || (para.Parent.Type != blackfriday.Item) {
+		return false
+	}
+
+	lit := node.Literal
+	if (len(lit) < 4) || (lit[0] != '[') || (lit[2] != ']') || (lit[3] != ' ') {
+		return false
+	}
+	return bytes.IndexByte([]byte(" xX"), lit[1]) >= 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DeedleFake/bog/markdown"
+	"github.com/russross/blackfriday/v2"
+)
+
+// linkFlags maps the names accepted by -external-links to the
+// blackfriday flags that they enable.
+var linkFlags = map[string]blackfriday.HTMLFlags{
+	"nofollow":   blackfriday.NofollowLinks,
+	"noreferrer": blackfriday.NoreferrerLinks,
+	"noopener":   blackfriday.NoopenerLinks,
+	"blank":      blackfriday.HrefTargetBlank,
+}
+
+// parseLinkFlags converts a list of names from linkFlags into the
+// corresponding combination of flags.
+func parseLinkFlags(names []string) (flags blackfriday.HTMLFlags, err error) {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		flag, ok := linkFlags[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown external link option %q", name)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// mdExtensions maps the names accepted by -md to the blackfriday
+// extensions that they toggle.
+var mdExtensions = map[string]blackfriday.Extensions{
+	"no-intra-emphasis":          blackfriday.NoIntraEmphasis,
+	"tables":                     blackfriday.Tables,
+	"fenced-code":                blackfriday.FencedCode,
+	"autolink":                   blackfriday.Autolink,
+	"strikethrough":              blackfriday.Strikethrough,
+	"lax-html-blocks":            blackfriday.LaxHTMLBlocks,
+	"space-headings":             blackfriday.SpaceHeadings,
+	"hard-line-break":            blackfriday.HardLineBreak,
+	"tab-size-eight":             blackfriday.TabSizeEight,
+	"footnotes":                  blackfriday.Footnotes,
+	"no-empty-line-before-block": blackfriday.NoEmptyLineBeforeBlock,
+	"heading-ids":                blackfriday.HeadingIDs,
+	"titleblock":                 blackfriday.Titleblock,
+	"auto-heading-ids":           blackfriday.AutoHeadingIDs,
+	"backslash-line-break":       blackfriday.BackslashLineBreak,
+	"definition-lists":           blackfriday.DefinitionLists,
+	"task-lists":                 markdown.TaskLists,
+}
+
+// parseExtensions applies a list of toggles of the extensions in
+// mdExtensions to ext. Each toggle is the name of an extension prefixed
+// with "+" to enable it or "-" to disable it. Names without a prefix
+// are enabled.
+func parseExtensions(ext blackfriday.Extensions, toggles []string) (blackfriday.Extensions, error) {
+	for _, toggle := range toggles {
+		toggle = strings.TrimSpace(toggle)
+		if toggle == "" {
+			continue
+		}
+
+		enable := true
+		switch toggle[0] {
+		case '-':
+			enable = false
+			fallthrough
+		case '+':
+			toggle = toggle[1:]
+		}
+
+		flag, ok := mdExtensions[toggle]
+		if !ok {
+			return 0, fmt.Errorf("unknown markdown extension %q", toggle)
+		}
+		if enable {
+			ext |= flag
+			continue
+		}
+		ext &^= flag
+	}
+	return ext, nil
+}
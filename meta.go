@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the body of a metadata comment.
+const (
+	metaAuto = "auto"
+	metaYAML = "yaml"
+	metaJSON = "json"
+	metaTOML = "toml"
+)
+
+// metaFormats are the valid values of -meta-format.
+var metaFormats = map[string]bool{
+	metaAuto: true,
+	metaYAML: true,
+	metaJSON: true,
+}
+
+// decodeMeta decodes the body of a metadata comment in the given
+// format into meta. If format is metaAuto, the body is decoded as
+// JSON if it starts with a '{' and as YAML otherwise.
+func decodeMeta(body []byte, format string, meta *map[string]interface{}) error {
+	if format == metaAuto {
+		format = metaYAML
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+			format = metaJSON
+		}
+	}
+
+	switch format {
+	case metaYAML:
+		return yaml.Unmarshal(body, meta)
+	case metaJSON:
+		return json.Unmarshal(body, meta)
+	case metaTOML:
+		tree, err := toml.LoadBytes(body)
+		if err != nil {
+			return err
+		}
+		*meta = fromTOML(tree.ToMap()).(map[string]interface{})
+		return nil
+	default:
+		return fmt.Errorf("unknown metadata format %q", format)
+	}
+}
+
+// fromTOML converts the types used by the TOML decoder that the rest
+// of the metadata handling doesn't understand. Local dates and
+// date-times become time.Times in UTC, like YAML timestamps, and
+// local times become strings.
+func fromTOML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fromTOML(e)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = fromTOML(e)
+		}
+		return v
+	case toml.LocalDate:
+		return v.In(time.UTC)
+	case toml.LocalDateTime:
+		return v.In(time.UTC)
+	case toml.LocalTime:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// A frontMatterFence describes a line that opens and closes a block
+// of front matter at the top of a page.
+type frontMatterFence struct {
+	// format is the format of the block's contents.
+	format string
+
+	// mustClose is true if a fence with no matching closing fence is
+	// an error. Otherwise, the fence is assumed to be part of the
+	// markdown.
+	mustClose bool
+}
+
+// frontMatterFences maps fences to their descriptions. A "---" with no
+// closing fence may just be a horizontal rule, but "+++" has no
+// meaning in markdown.
+var frontMatterFences = map[string]frontMatterFence{
+	"---": {format: metaYAML},
+	"+++": {format: metaTOML, mustClose: true},
+}
+
+// splitFrontMatter splits a block of front matter off of the top of
+// src. The block must start on the first line with one of the fences
+// in frontMatterFences and end with a line consisting of the same
+// fence. Both LF and CRLF line endings are accepted. If src doesn't
+// start with a complete block, ok is false and src is left for the
+// markdown parser, unless the fence must be closed, in which case an
+// error is returned.
+func splitFrontMatter(src []byte) (format string, fm, body []byte, ok bool, err error) {
+	line, rest := splitLine(src)
+	fence, ok := frontMatterFences[string(line)]
+	if !ok {
+		return "", nil, src, false, nil
+	}
+	marker := line
+
+	start := rest
+	for len(rest) > 0 {
+		var next []byte
+		line, next = splitLine(rest)
+		if bytes.Equal(bytes.TrimRight(line, " \t"), marker) {
+			return fence.format, start[:len(start)-len(rest)], next, true, nil
+		}
+		rest = next
+	}
+
+	if fence.mustClose {
+		return "", nil, src, false, fmt.Errorf("front matter opened with %q is never closed", marker)
+	}
+	return "", nil, src, false, nil
+}
+
+// splitLine splits the first line off of src, returning the line
+// without its line ending and the remainder of src after it.
+func splitLine(src []byte) (line, rest []byte) {
+	i := bytes.IndexByte(src, '\n')
+	if i < 0 {
+		return bytes.TrimSuffix(src, []byte("\r")), nil
+	}
+	return bytes.TrimSuffix(src[:i], []byte("\r")), src[i+1:]
+}
+
+// timeLayouts are the layouts that string times in metadata are
+// parsed with, in order.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// metaTime converts a metadata value to a time. The value can either
+// already be a time.Time or be a string in one of the layouts in
+// timeLayouts. If it is neither, ok is false.
+func metaTime(v interface{}) (t time.Time, ok bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+
+	case string:
+		for _, layout := range timeLayouts {
+			t, err := time.Parse(layout, v)
+			if err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// normalizeTime makes sure that meta["time"] is a time.Time, parsing
+// it if it is a string and replacing it with modTime if it is missing
+// or of any other type. An error is returned if it is a string that
+// doesn't match any of timeLayouts.
+func normalizeTime(meta map[string]interface{}, modTime time.Time) error {
+	switch v := meta["time"].(type) {
+	case time.Time:
+		return nil
+
+	case string:
+		t, ok := metaTime(v)
+		if !ok {
+			return fmt.Errorf("time %q does not match any supported layout: %v", v, strings.Join(timeLayouts, ", "))
+		}
+		meta["time"] = t
+		return nil
+
+	default:
+		meta["time"] = modTime
+		return nil
+	}
+}
+
+// metaTypes are the types that the metadata that bog itself uses are
+// expected to have, as checked by checkMeta.
+var metaTypes = map[string]string{
+	"title":      "string",
+	"desc":       "string",
+	"author":     "string",
+	"slug":       "string",
+	"permalink":  "string",
+	"outdir":     "string",
+	"layout":     "string",
+	"hlstyle":    "string",
+	"collection": "string",
+	"draft":      "bool",
+	"index":      "bool",
+	"list":       "bool",
+	"anchors":    "bool",
+	"tags":       "list",
+	"outputs":    "list",
+}
+
+// checkMeta returns an error if any of the metadata in meta that bog
+// uses has a type other than the one that it expects, which would
+// otherwise cause the value to be silently ignored, or if the title is
+// blank. Strings are also accepted wherever lists are, and the time
+// must be either a time or a string.
+func checkMeta(meta map[string]interface{}) error {
+	keys := make([]string, 0, len(metaTypes))
+	for k := range metaTypes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v, ok := meta[k]
+		if !ok {
+			continue
+		}
+
+		switch metaTypes[k] {
+		case "string":
+			_, ok = v.(string)
+		case "bool":
+			_, ok = v.(bool)
+		case "list":
+			switch v.(type) {
+			case string, []interface{}:
+			default:
+				ok = false
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%q is a %T, not a %v", k, v, metaTypes[k])
+		}
+	}
+
+	switch v := meta["time"].(type) {
+	case nil, string, time.Time:
+	default:
+		return fmt.Errorf("%q is a %T, not a time", "time", v)
+	}
+
+	if title, _ := meta["title"].(string); strings.TrimSpace(title) == "" {
+		return errors.New("title is blank")
+	}
+
+	return nil
+}
+
+// sidecarPaths returns the paths at which a sidecar metadata file for
+// the source at path may exist, in order of preference.
+func sidecarPaths(path string) []string {
+	return []string{
+		path + ".yaml",
+		RemoveExt(path) + ".meta.yaml",
+	}
+}
+
+// readSidecar reads the sidecar metadata for the source at path. If
+// there is no sidecar file, it returns nil.
+func readSidecar(path string) (map[string]interface{}, error) {
+	for _, p := range sidecarPaths(path) {
+		meta, err := readMetaFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		return meta, err
+	}
+
+	return nil, nil
+}
+
+// readMetaFile reads page metadata from the YAML file at path.
+func readMetaFile(path string) (map[string]interface{}, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]interface{})
+	err = decodeMeta(body, metaYAML, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("decode %q: %w", path, err)
+	}
+	return meta, nil
+}
+
+// mergeMeta copies the top-level keys of src into dst. If overwrite
+// is false, keys that are already in dst are left alone.
+func mergeMeta(dst, src map[string]interface{}, overwrite bool) {
+	for k, v := range src {
+		if _, ok := dst[k]; ok && !overwrite {
+			continue
+		}
+		dst[k] = v
+	}
+}
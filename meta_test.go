@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// parseFrontMatter splits the front matter off of src and decodes it.
+func parseFrontMatter(t *testing.T, src []byte) (format string, meta map[string]interface{}, body []byte) {
+	t.Helper()
+
+	format, fm, body, ok, err := splitFrontMatter(src)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+	if !ok {
+		t.Fatalf("no front matter in %q", src)
+	}
+
+	err = decodeMeta(fm, format, &meta)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return format, meta, body
+}
+
+func TestFrontMatterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		fence string
+		src   string
+	}{
+		{
+			name:  "YAML",
+			fence: "---",
+			src: "---\r\n" +
+				"title: First Post\r\n" +
+				"time: 2020-05-02T10:00:00Z\r\n" +
+				"tags: [a, b]\r\n" +
+				"draft: false\r\n" +
+				"---\r\n" +
+				"# Heading\r\n",
+		},
+		{
+			name:  "TOML",
+			fence: "+++",
+			src: "+++\n" +
+				"title = \"First Post\"\n" +
+				"time = 2020-05-02T10:00:00Z\n" +
+				"tags = [\"a\", \"b\"]\n" +
+				"weight = 3\n" +
+				"[template]\n" +
+				"enabled = false\n" +
+				"+++\n" +
+				"# Heading\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, meta, body := parseFrontMatter(t, []byte(test.src))
+
+			var fm []byte
+			var err error
+			switch format {
+			case metaYAML:
+				fm, err = yaml.Marshal(meta)
+			case metaTOML:
+				var tree *toml.Tree
+				tree, err = toml.TreeFromMap(meta)
+				if err == nil {
+					fm, err = tree.Marshal()
+				}
+			default:
+				t.Fatalf("unexpected format %q", format)
+			}
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			var buf bytes.Buffer
+			buf.WriteString(test.fence + "\n")
+			buf.Write(fm)
+			buf.WriteString(test.fence + "\n")
+			buf.Write(body)
+
+			format2, meta2, body2 := parseFrontMatter(t, buf.Bytes())
+			if format2 != format {
+				t.Errorf("format: got %q, want %q", format2, format)
+			}
+			if !reflect.DeepEqual(meta2, meta) {
+				t.Errorf("meta:\ngot  %#v\nwant %#v", meta2, meta)
+			}
+			if !bytes.Equal(body2, body) {
+				t.Errorf("body: got %q, want %q", body2, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// preserveWhitespace contains the elements whose contents are left
+// alone when minifying HTML because whitespace in them is
+// significant or they aren't HTML at all.
+var preserveWhitespace = map[string]bool{
+	"pre":      true,
+	"code":     true,
+	"textarea": true,
+	"script":   true,
+	"style":    true,
+}
+
+// minifyProcessor is an OutputProcessor that minifies HTML files and
+// leaves everything else alone.
+var minifyProcessor = OutputProcessorFunc(func(path string, content []byte) ([]byte, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".html") {
+		return content, nil
+	}
+	return minifyHTML(content), nil
+})
+
+// minifyHTML removes comments from an HTML document and collapses
+// runs of whitespace in its text into single spaces. Text inside of
+// the elements in preserveWhitespace, such as highlighted code and
+// inline styles, is copied as is, as are the tags themselves and
+// conditional comments.
+func minifyHTML(src []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(src))
+
+	var preserve int
+	t := html.NewTokenizer(bytes.NewReader(src))
+	for {
+		tt := t.Next()
+		switch tt {
+		case html.ErrorToken:
+			if t.Err() != io.EOF {
+				// As in stripHTML, reading from a bytes.Reader can't
+				// fail.
+				panic(t.Err())
+			}
+			return buf.Bytes()
+
+		case html.CommentToken:
+			if bytes.HasPrefix(t.Text(), []byte("[if")) {
+				buf.Write(t.Raw())
+			}
+
+		case html.TextToken:
+			if preserve > 0 {
+				buf.Write(t.Raw())
+				continue
+			}
+			collapseHTMLSpace(&buf, t.Raw())
+
+		case html.StartTagToken, html.EndTagToken:
+			raw := t.Raw()
+			name, _ := t.TagName()
+			if preserveWhitespace[string(name)] {
+				if tt == html.StartTagToken {
+					preserve++
+				} else if preserve > 0 {
+					preserve--
+				}
+			}
+			buf.Write(raw)
+
+		default:
+			buf.Write(t.Raw())
+		}
+	}
+}
+
+// collapseHTMLSpace writes text to buf with every run of HTML
+// whitespace replaced by a single space. Whitespace at the start of
+// text is dropped if buf already ends in a space, such as when a
+// comment between two pieces of text was removed.
+func collapseHTMLSpace(buf *bytes.Buffer, text []byte) {
+	space := bytes.HasSuffix(buf.Bytes(), []byte(" "))
+	for _, c := range text {
+		switch c {
+		case ' ', '\t', '\n', '\r', '\f':
+			if !space {
+				buf.WriteByte(' ')
+			}
+			space = true
+		default:
+			buf.WriteByte(c)
+			space = false
+		}
+	}
+}
@@ -4,14 +4,34 @@ package multierr
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"sync"
 )
 
 // MultiErr is a concurrency structure for handling the potential of
 // multiple concurrently produced errors.
 type MultiErr struct {
-	wg     sync.WaitGroup
-	cancel context.CancelFunc
+	// Serial, if true, causes Go to run functions to completion before
+	// returning instead of running them concurrently. Once a function
+	// has returned an error, further calls to Go don't run their
+	// functions at all unless the MultiErr was created with
+	// WithContextNoCancel. This is mostly useful for debugging.
+	Serial bool
+
+	// Limit, if positive, is the maximum number of functions that are
+	// run concurrently. Once that many are running, Go blocks until
+	// one of them finishes or the context is canceled. It must not be
+	// changed after the first call to Go.
+	Limit int
+
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	noCancel bool
+
+	semOnce sync.Once
+	sem     chan struct{}
 
 	errs []error
 	merr sync.Mutex
@@ -24,27 +44,91 @@ type MultiErr struct {
 func WithContext(ctx context.Context) (*MultiErr, context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	return &MultiErr{
+		ctx:    ctx,
 		cancel: cancel,
 	}, ctx
 }
 
+// WithContextNoCancel is like WithContext, but the returned MultiErr
+// doesn't cancel the context when a function returns an error, so
+// that the remaining functions run to completion and all of their
+// errors are collected. The context is still canceled by Wait.
+func WithContextNoCancel(ctx context.Context) (*MultiErr, context.Context) {
+	me, ctx := WithContext(ctx)
+	me.noCancel = true
+	return me, ctx
+}
+
 // Go starts a function concurrently. If the function returns an
 // error, the MultiErr is canceled and the error is added to the list
 // of returned arrors.
+//
+// If Limit is positive and the limit has been reached, Go waits for a
+// running function to finish first. If the context is canceled while
+// waiting, f is not run at all, and the context's error is recorded
+// unless another function's error caused the cancellation.
 func (me *MultiErr) Go(f func() error) {
+	if me.Serial {
+		if (len(me.errs) == 0) || me.noCancel {
+			me.run(f)
+		}
+		return
+	}
+
+	if me.Limit > 0 {
+		me.semOnce.Do(func() {
+			me.sem = make(chan struct{}, me.Limit)
+		})
+
+		select {
+		case me.sem <- struct{}{}:
+		case <-me.ctx.Done():
+			me.merr.Lock()
+			if len(me.errs) == 0 {
+				me.errs = append(me.errs, me.ctx.Err())
+			}
+			me.merr.Unlock()
+			return
+		}
+	}
+
 	me.wg.Add(1)
 	go func() {
 		defer me.wg.Done()
+		if me.sem != nil {
+			defer func() { <-me.sem }()
+		}
+		me.run(f)
+	}()
+}
 
-		err := f()
-		if err != nil {
-			me.merr.Lock()
+// GoContext is like Go, but passes f the context returned from
+// WithContext so that it doesn't need to capture it. The context is
+// canceled in the same circumstances as it is for functions started
+// with Go.
+func (me *MultiErr) GoContext(f func(context.Context) error) {
+	me.Go(func() error {
+		return f(me.ctx)
+	})
+}
+
+// run runs f, recording its error if it returns one. A cancellation
+// error returned after another function's error has been recorded
+// isn't recorded, as it's most likely just a result of that error
+// canceling the context.
+func (me *MultiErr) run(f func() error) {
+	err := f()
+	if err != nil {
+		me.merr.Lock()
+		if (len(me.errs) == 0) || !errors.Is(err, context.Canceled) || (me.ctx.Err() == nil) {
 			me.errs = append(me.errs, err)
-			me.merr.Unlock()
+		}
+		me.merr.Unlock()
 
+		if !me.noCancel {
 			me.cancel()
 		}
-	}()
+	}
 }
 
 // Wait waits for all of the functions started with Go to finish, then
@@ -63,3 +147,63 @@ func (me *MultiErr) Wait() (errs []error) {
 
 	return errs
 }
+
+// Errors is an error made up of several other errors, such as those
+// returned from Wait. It works with errors.Is and errors.As, which
+// match it if they match any of its errors.
+type Errors []error
+
+// Combine returns a single error made up of all of the non-nil errors
+// in errs. If there are none, it returns nil, and if there's only one,
+// it returns that error as is. Otherwise, it returns an Errors.
+func Combine(errs []error) error {
+	var r Errors
+	for _, err := range errs {
+		if err != nil {
+			r = append(r, err)
+		}
+	}
+
+	switch len(r) {
+	case 0:
+		return nil
+	case 1:
+		return r[0]
+	default:
+		return r
+	}
+}
+
+func (errs Errors) Error() string {
+	strs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		strs = append(strs, err.Error())
+	}
+	return strings.Join(strs, "; ")
+}
+
+// Unwrap returns the errors that errs is made up of.
+func (errs Errors) Unwrap() []error {
+	return errs
+}
+
+// Is reports whether any of the errors in errs matches target.
+func (errs Errors) Is(target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error in errs that matches target and, if there
+// is one, sets target to it and returns true.
+func (errs Errors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package multierr_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DeedleFake/bog/multierr"
+)
+
+func TestGoContext(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	eg, ctx := multierr.WithContext(context.Background())
+	failed := make(chan struct{})
+	eg.Go(func() error {
+		defer close(failed)
+		return errFailed
+	})
+	for i := 0; i < 10; i++ {
+		eg.GoContext(func(fctx context.Context) error {
+			if fctx != ctx {
+				t.Errorf("got a context other than the MultiErr's")
+			}
+
+			<-failed
+			<-fctx.Done()
+			return fctx.Err()
+		})
+	}
+
+	errs := eg.Wait()
+	if (len(errs) != 1) || (errs[0] != errFailed) {
+		t.Errorf("got %v, want only %v", errs, errFailed)
+	}
+}
+
+func TestGoContextCanceled(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	eg, _ := multierr.WithContextNoCancel(parent)
+	cancel()
+
+	eg.GoContext(func(ctx context.Context) error {
+		return ctx.Err()
+	})
+
+	errs := eg.Wait()
+	if (len(errs) != 1) || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("got %v, want only %v", errs, context.Canceled)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	err1, err2 := errors.New("one"), errors.New("two")
+	tests := []struct {
+		name string
+		errs []error
+		want error
+	}{
+		{"None", nil, nil},
+		{"Nil", []error{nil, nil}, nil},
+		{"One", []error{nil, err1}, err1},
+		{"Two", []error{err1, nil, err2}, multierr.Errors{err1, err2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := multierr.Combine(test.errs)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+
+	err := multierr.Combine([]error{err1, context.Canceled})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, err1) || errors.Is(err, err2) {
+		t.Errorf("errors.Is doesn't match the errors in %v", err)
+	}
+	if got, want := err.Error(), "one; context canceled"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSerial(t *testing.T) {
+	err1, err2 := errors.New("one"), errors.New("two")
+	fail := map[int]error{1: err1, 3: err2}
+
+	tests := []struct {
+		name  string
+		new   func(context.Context) (*multierr.MultiErr, context.Context)
+		order []int
+		errs  []error
+	}{
+		{"Cancel", multierr.WithContext, []int{0, 1}, []error{err1}},
+		{"NoCancel", multierr.WithContextNoCancel, []int{0, 1, 2, 3, 4}, []error{err1, err2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eg, _ := test.new(context.Background())
+			eg.Serial = true
+
+			var order []int
+			for i := 0; i < 5; i++ {
+				i := i
+				eg.Go(func() error {
+					order = append(order, i)
+					return fail[i]
+				})
+			}
+
+			errs := eg.Wait()
+			if !reflect.DeepEqual(order, test.order) {
+				t.Errorf("ran %v, want %v", order, test.order)
+			}
+			if !reflect.DeepEqual(errs, test.errs) {
+				t.Errorf("got errors %v, want %v", errs, test.errs)
+			}
+
+			err := multierr.Combine(errs)
+			for _, want := range test.errs {
+				if !errors.Is(err, want) {
+					t.Errorf("combined error %v doesn't match %v", err, want)
+				}
+			}
+		})
+	}
+}
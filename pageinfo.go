@@ -6,16 +6,20 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/DeedleFake/bog/internal/bufpool"
 	"github.com/DeedleFake/bog/markdown"
 	"github.com/Depado/bfchroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
 	"github.com/gosimple/slug"
 	"github.com/russross/blackfriday/v2"
 	"golang.org/x/net/html"
-	"gopkg.in/yaml.v3"
 )
 
 // defaultMeta contains a mapping of names to functions that are
@@ -31,39 +35,96 @@ var defaultMeta = map[string]func(os.FileInfo) interface{}{
 	},
 }
 
+// ErrEmptyPage is returned by LoadPage if the page's source file is
+// empty.
+var ErrEmptyPage = errors.New("empty source file")
+
 // PageInfo contains information about a page.
 type PageInfo struct {
+	// Path is the path of the file that the page was loaded from.
+	Path string
+
 	InputInfo os.FileInfo
 	Meta      map[string]interface{}
 	Content   string
+
+	// dir is the slash-separated directory containing the page's
+	// source, relative to the source directory.
+	dir string
+
+	// headings are the headings in the page's content.
+	headings []heading
+
+	// prev and next are the pages before and after the page in the
+	// site's list of pages, if it is in it.
+	prev, next *PageInfo
+
+	defaultOutputs []string
+	contents       map[string]string
 }
 
 // LoadPage loads a page from the given path and renders it with the
-// given data.
+// given data. The page's metadata is read from front matter at the
+// top of the file, if there is any, and from metadata comments, with
+// the front matter taking precedence.
 func LoadPage(path string, data interface{}, options ...PageOption) (*PageInfo, error) {
-	var config pageConfig
+	config := pageConfig{
+		ContentTemplate: true,
+		MetaFormat:      metaAuto,
+		Funcs:           tmplFuncs,
+		Outputs:         defaultOutputs,
+		WordsPerMinute:  defaultWordsPerMinute,
+		Extensions:      blackfriday.CommonExtensions | markdown.TaskLists,
+		HTMLFlags:       blackfriday.CommonHTMLFlags,
+	}
 	for _, option := range options {
 		option(&config)
 	}
 
 	buf, err := readFile(path)
-	defer bufpool.Put(buf)
 	if err != nil {
 		return nil, err
 	}
+	defer bufpool.Put(buf)
+	if buf.Len() == 0 {
+		return nil, ErrEmptyPage
+	}
 
 	inputInfo, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
-	md := blackfriday.New(blackfriday.WithExtensions(blackfriday.CommonExtensions))
-	node := md.Parse(buf.Bytes())
+	fmFormat, fm, body, hasFM, err := splitFrontMatter(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	md := blackfriday.New(blackfriday.WithExtensions(config.Extensions))
+	node := md.Parse(body)
 
-	meta, err := getMeta(node, true)
+	meta, err := getMeta(node, config.MetaFormat, true)
 	if err != nil {
 		return nil, fmt.Errorf("get meta: %w", err)
 	}
+	if hasFM {
+		fmMeta := make(map[string]interface{})
+		err = decodeMeta(fm, fmFormat, &fmMeta)
+		if err != nil {
+			return nil, fmt.Errorf("decode front matter: %w", err)
+		}
+		mergeMeta(meta, fmMeta, true)
+	}
+	sidecar, err := readSidecar(path)
+	if err != nil {
+		return nil, fmt.Errorf("read sidecar: %w", err)
+	}
+	mergeMeta(meta, sidecar, config.SidecarWins)
+
+	if config.ExpandEnv {
+		expandEnv(meta)
+	}
+	mergeMeta(meta, config.Defaults, false)
 	for k, f := range defaultMeta {
 		if _, ok := meta[k]; ok {
 			continue
@@ -71,10 +132,81 @@ func LoadPage(path string, data interface{}, options ...PageOption) (*PageInfo,
 
 		meta[k] = f(inputInfo)
 	}
+	if config.Strict {
+		err = checkMeta(meta)
+		if err != nil {
+			return nil, fmt.Errorf("check meta: %w", err)
+		}
+	}
+	err = normalizeTime(meta, inputInfo.ModTime())
+	if err != nil {
+		return nil, err
+	}
+
+	words := countWords(node)
+	if _, ok := meta["wordcount"]; !ok {
+		meta["wordcount"] = words
+	}
+	if _, ok := meta["readingtime"]; !ok {
+		meta["readingtime"] = readingTime(words, config.WordsPerMinute)
+	}
 
 	page := &PageInfo{
+		Path:      path,
 		InputInfo: inputInfo,
 		Meta:      meta,
+
+		defaultOutputs: config.Outputs,
+	}
+	delimLeft, _ := page.contentDelims(config.ContentTemplate)
+	page.headings = findHeadings(node, delimLeft)
+
+	if config.SourceDir != "" {
+		rel, err := filepath.Rel(config.SourceDir, filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+		page.dir = filepath.ToSlash(rel)
+	}
+
+	err = checkFormats(page.Outputs())
+	if err != nil {
+		return nil, err
+	}
+	if dir := page.OutputDir(); !isLocal(dir) {
+		return nil, fmt.Errorf("output directory %q is outside of the output root", dir)
+	}
+	if permalink := page.permalink(); (permalink != "") && !isLocal(strings.TrimPrefix(permalink, "/")) {
+		return nil, fmt.Errorf("permalink %q is outside of the output root", permalink)
+	}
+	if name, _ := page.Meta["slug"].(string); strings.ContainsAny(name, "/\\") {
+		return nil, fmt.Errorf("slug %q contains a path separator", name)
+	}
+
+	style := config.Style
+	if v, ok := page.Meta["hlstyle"]; ok {
+		name, _ := v.(string)
+		if _, ok := styles.Registry[name]; !ok {
+			return nil, fmt.Errorf("unknown highlighting style %q", v)
+		}
+		style = name
+	}
+
+	var renderer blackfriday.Renderer = &markdown.ExternalLinkRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: config.HTMLFlags,
+		}),
+		LinkFlags: config.LinkFlags,
+	}
+	anchors := config.Anchors
+	if v, ok := page.Meta["anchors"].(bool); ok {
+		anchors = v
+	}
+	if anchors {
+		renderer = &markdown.AnchorRenderer{Renderer: renderer}
+	}
+	if config.Extensions&markdown.TaskLists != 0 {
+		renderer = &markdown.TaskListRenderer{Renderer: renderer}
 	}
 
 	mdbuf := bufpool.Get()
@@ -83,32 +215,86 @@ func LoadPage(path string, data interface{}, options ...PageOption) (*PageInfo,
 		mdbuf,
 		node,
 		bfchroma.NewRenderer(
-			bfchroma.Style(config.Style),
+			bfchroma.Style(style),
+			bfchroma.ChromaOptions(config.chromaOptions()...),
+			bfchroma.Extend(renderer),
 		),
+		buf.Bytes(),
 		data,
+		config.ContentTemplate,
+		config.missingKey(),
+		config.Funcs,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("render HTML: %w", err)
 	}
-	page.Content = mdbuf.String()
+	resolve := page.resolveHeadings(mdbuf.String())
+	page.Content = resolve.Replace(mdbuf.String())
+	if _, ok := page.Meta["summary"]; !ok {
+		page.Meta["summary"] = summarize(page.Content)
+	}
+
+	for _, name := range page.Outputs() {
+		format := outputFormats[name]
+		if format.Renderer == nil {
+			continue
+		}
+
+		mdbuf.Reset()
+		err = page.render(mdbuf, node, format.Renderer(), buf.Bytes(), data, config.ContentTemplate, config.missingKey(), config.Funcs)
+		if err != nil {
+			return nil, fmt.Errorf("render %v: %w", name, err)
+		}
+		if page.contents == nil {
+			page.contents = make(map[string]string)
+		}
+		page.contents[name] = resolve.Replace(mdbuf.String())
+	}
 
 	return page, nil
 }
 
 // render renders the page into buf twice, once as just pure markdown
-// and once as a template produced from that markdown.
-func (page *PageInfo) render(buf *bytes.Buffer, root *blackfriday.Node, renderer blackfriday.Renderer, data interface{}) error {
+// and once as a template produced from that markdown. If tmplContent
+// is false, the second pass is skipped and the markdown output is left
+// in buf as is. The page's "template.enabled" metadata, if present,
+// overrides tmplContent. The template has access to the functions in
+// funcs. Errors in the template are returned as a *contentError with
+// the line translated to a line in src, the page's markdown source.
+//
+// Markdown rendering escapes some characters in template actions, such
+// as the quotes around strings, especially in link destinations, so
+// they are unescaped again before the template is parsed. See
+// unescapeActions.
+//
+// Each page parses its own content template, so content templates are
+// never shared between goroutines. The content template is named
+// after the page's source path so that its name can't collide with
+// any templates defined in the page templates. Page templates should
+// therefore refer to the rendered content via .Page.Content, not via
+// a {{template}} action.
+func (page *PageInfo) render(buf *bytes.Buffer, root *blackfriday.Node, renderer blackfriday.Renderer, src []byte, data interface{}, tmplContent bool, missingKey string, funcs template.FuncMap) error {
 	err := markdown.Render(buf, root, renderer)
 	if err != nil {
 		return fmt.Errorf("render markdown: %w", err)
 	}
 
-	delimLeft, _ := page.getMeta("template", "delims", "left").(string)
-	delimRight, _ := page.getMeta("template", "delims", "right").(string)
+	delimLeft, delimRight := page.contentDelims(tmplContent)
+	if delimLeft == "" {
+		return nil
+	}
+
+	rendered := unescapeActions(buf.String(), delimLeft, delimRight)
+	contentErr := func(op string, err error) error {
+		return &contentError{
+			Line: sourceLine(string(src), rendered, delimLeft, templateLine(err, page.Path)),
+			Err:  fmt.Errorf("%v: %w", op, err),
+		}
+	}
 
-	tmpl, err := template.New("content").Funcs(tmplFuncs).Delims(delimLeft, delimRight).Parse(buf.String())
+	tmpl, err := template.New(page.Path).Funcs(funcs).Option("missingkey="+missingKey).Delims(delimLeft, delimRight).Parse(rendered)
 	if err != nil {
-		return fmt.Errorf("template parse: %w", err)
+		return contentErr("template parse", err)
 	}
 
 	buf.Reset()
@@ -117,12 +303,133 @@ func (page *PageInfo) render(buf *bytes.Buffer, root *blackfriday.Node, renderer
 		"Data": data,
 	})
 	if err != nil {
-		return fmt.Errorf("template execute: %w", err)
+		return contentErr("template execute", err)
 	}
 
 	return nil
 }
 
+// contentDelims returns the delimiters of the page's content template,
+// or empty strings if its content isn't executed as one. tmplContent
+// is whether it is by default, which the page's "template.enabled"
+// metadata overrides. A blank right delimiter means the default.
+func (page *PageInfo) contentDelims(tmplContent bool) (left, right string) {
+	if enabled, ok := page.getMeta("template", "enabled").(bool); ok {
+		tmplContent = enabled
+	}
+	if !tmplContent {
+		return "", ""
+	}
+
+	left, _ = page.getMeta("template", "delims", "left").(string)
+	right, _ = page.getMeta("template", "delims", "right").(string)
+	if left == "" {
+		left = "{{"
+	}
+	return left, right
+}
+
+// actionUnescaper undoes the escaping that markdown rendering, with
+// or without smartypants, does to characters in template actions.
+var actionUnescaper = strings.NewReplacer(
+	"&quot;", `"`,
+	"&#34;", `"`,
+	"&ldquo;", `"`,
+	"&rdquo;", `"`,
+	"&#39;", "'",
+	"&lsquo;", "'",
+	"&rsquo;", "'",
+	"&lt;", "<",
+	"&gt;", ">",
+	"&amp;", "&",
+)
+
+// unescapeActions unescapes the HTML entities that markdown rendering
+// may have put in the template actions, delimited by left and right,
+// in content. A blank right delimiter means the default.
+func unescapeActions(content, left, right string) string {
+	if right == "" {
+		right = "}}"
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.Index(content, left)
+		if start < 0 {
+			break
+		}
+		start += len(left)
+		end := strings.Index(content[start:], right)
+		if end < 0 {
+			break
+		}
+		end += start
+
+		sb.WriteString(content[:start])
+		sb.WriteString(actionUnescaper.Replace(content[start:end]))
+		content = content[end:]
+	}
+	sb.WriteString(content)
+
+	return sb.String()
+}
+
+// sourceLine approximately translates a line in the rendered content
+// of a page to the corresponding line in its markdown source. Markdown
+// rendering leaves template actions alone, so the nth action opened
+// by delim in the rendered content is assumed to be the nth one in the
+// source, and the line is found relative to the closest action at or
+// before it. It returns 0 if the line can't be translated.
+func sourceLine(src, rendered, delim string, line int) int {
+	if line <= 0 {
+		return 0
+	}
+
+	end := len(rendered)
+	for i, n := 0, 0; i < len(rendered); i++ {
+		if rendered[i] != '\n' {
+			continue
+		}
+		n++
+		if n == line {
+			end = i
+			break
+		}
+	}
+
+	n := strings.Count(rendered[:end], delim)
+	if n == 0 {
+		return 0
+	}
+
+	rpos := nthIndex(rendered, delim, n)
+	spos := nthIndex(src, delim, n)
+	if spos < 0 {
+		return 0
+	}
+
+	rline := 1 + strings.Count(rendered[:rpos], "\n")
+	sline := 1 + strings.Count(src[:spos], "\n")
+	return sline + (line - rline)
+}
+
+// nthIndex returns the index of the nth, starting from 1, occurrence
+// of sub in str, or -1 if there aren't that many.
+func nthIndex(str, sub string, n int) int {
+	var off int
+	for ; n > 0; n-- {
+		i := strings.Index(str[off:], sub)
+		if i < 0 {
+			return -1
+		}
+		off += i
+		if n > 1 {
+			off += len(sub)
+		}
+	}
+	return off
+}
+
 func (page *PageInfo) getMeta(keys ...string) interface{} {
 	if len(keys) == 0 {
 		panic(errors.New("no keys provided"))
@@ -148,16 +455,164 @@ func (page *PageInfo) Input() string {
 	return page.InputInfo.Name()
 }
 
-// Output returns the name of the file that the page will output to.
+// Output returns the name of the file that the page will output to
+// in its first output format.
 func (page *PageInfo) Output() string {
-	return slug.Make(fmt.Sprint(page.Meta["title"])) + ".html"
+	return page.OutputFormat(page.Outputs()[0])
+}
+
+// ID returns a stable identifier for the page, which is the
+// slash-separated path of its output relative to the output
+// directory, without the extension.
+func (page *PageInfo) ID() string {
+	return RemoveExt(page.Output())
+}
+
+// OutputFormat returns the slash-separated path, relative to the
+// output directory, of the file that the page will output to in the
+// given format.
+//
+// If the page has a "permalink" in its metadata, it is used as the
+// path, relative to the root of the output directory regardless of
+// "outdir", with its extension replaced by the format's. A permalink
+// ending in a slash outputs to index in that directory. Otherwise, the
+// file is named after the page's "slug" metadata, or its slugified
+// title if it has none, in the page's output directory.
+func (page *PageInfo) OutputFormat(format string) string {
+	ext := outputFormats[format].Ext
+
+	if permalink := page.permalink(); permalink != "" {
+		if strings.HasSuffix(permalink, "/") {
+			permalink += "index"
+		}
+		return path.Clean(RemoveExt(strings.TrimPrefix(permalink, "/")) + ext)
+	}
+
+	name, _ := page.Meta["slug"].(string)
+	if name == "" {
+		name = slug.Make(fmt.Sprint(page.Meta["title"]))
+	}
+	return path.Join(page.OutputDir(), name+ext)
+}
+
+// permalink returns the page's "permalink" metadata, or an empty
+// string if it doesn't have one.
+func (page *PageInfo) permalink() string {
+	permalink, _ := page.Meta["permalink"].(string)
+	return permalink
+}
+
+// isLocal returns true if the slash-separated path p is relative and
+// does not lead outside of the directory that it is relative to.
+func isLocal(p string) bool {
+	p = path.Clean(p)
+	return !path.IsAbs(p) && (p != "..") && !strings.HasPrefix(p, "../")
+}
+
+// OutputDir returns the slash-separated directory, relative to the
+// output directory, that the page will output to, as given by its
+// "outdir" metadata. If the page has no "outdir", the directory that
+// its source is in relative to the source directory is used instead,
+// and if the source is directly in the source directory an empty
+// string is returned.
+func (page *PageInfo) OutputDir() string {
+	dir, _ := page.Meta["outdir"].(string)
+	if dir == "" {
+		dir = page.dir
+	}
+	if (dir == "") || (dir == ".") {
+		return ""
+	}
+	return path.Clean(dir)
+}
+
+// Layout returns the name of the layout that the page selects with
+// its "layout" metadata, or an empty string if it doesn't select one.
+func (page *PageInfo) Layout() string {
+	layout, _ := page.Meta["layout"].(string)
+	return layout
 }
 
-// Execute renders the page to w.
-func (page *PageInfo) Execute(w io.Writer, tmpl *template.Template, data interface{}) error {
+// hasOutput returns true if the page is output in the given format.
+func (page *PageInfo) hasOutput(format string) bool {
+	for _, f := range page.Outputs() {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Listed returns true if the page should be included in listings of
+// pages, such as the index and collections. Pages that set "index" or
+// "list" to false in their metadata are still generated, but are left
+// out of listings.
+func (page *PageInfo) Listed() bool {
+	for _, key := range []string{"index", "list"} {
+		if listed, ok := page.Meta[key].(bool); ok && !listed {
+			return false
+		}
+	}
+	return true
+}
+
+// Prev returns the page before the page in the site's sorted list of
+// pages, or nil if it is the first or isn't listed.
+func (page *PageInfo) Prev() *PageInfo {
+	return page.prev
+}
+
+// Next returns the page after the page in the site's sorted list of
+// pages, or nil if it is the last or isn't listed.
+func (page *PageInfo) Next() *PageInfo {
+	return page.next
+}
+
+// Outputs returns the names of the formats that the page should be
+// generated in, as listed in its "outputs" metadata.
+func (page *PageInfo) Outputs() []string {
+	switch outputs := page.Meta["outputs"].(type) {
+	case string:
+		return []string{outputs}
+
+	case []interface{}:
+		formats := make([]string, 0, len(outputs))
+		for _, format := range outputs {
+			formats = append(formats, fmt.Sprint(format))
+		}
+		if len(formats) > 0 {
+			return formats
+		}
+	}
+
+	return page.defaultOutputs
+}
+
+// ContentAs returns the content of the page as rendered for the given
+// output format. If the format doesn't render content separately, or
+// the page isn't output in that format, the HTML content is returned.
+func (page *PageInfo) ContentAs(format string) string {
+	if content, ok := page.contents[format]; ok {
+		return content
+	}
+	return page.Content
+}
+
+// Execute renders the page to w. tmpl may be shared between pages
+// that are executing concurrently, so it must be fully parsed before
+// Execute is called and not modified while in use.
+//
+// Along with the page and the data, the template is given pages, the
+// site's list of pages in the order given by -sort, as .Pages, and the
+// pages before and after the page in that list as .Prev and .Next.
+// Those are nil at the ends of the list and if the page isn't listed.
+func (page *PageInfo) Execute(w io.Writer, tmpl *template.Template, data interface{}, pages []*PageInfo) error {
 	err := tmpl.Execute(w, map[string]interface{}{
-		"Page": page,
-		"Data": data,
+		"Page":  page,
+		"Data":  data,
+		"Pages": pages,
+		"Prev":  page.Prev(),
+		"Next":  page.Next(),
 	})
 	if err != nil {
 		return fmt.Errorf("template execute: %w", err)
@@ -166,10 +621,15 @@ func (page *PageInfo) Execute(w io.Writer, tmpl *template.Template, data interfa
 	return nil
 }
 
-// getMeta finds and retrieves metadata from a parsed markdown tree.
-// If unlink is true, the node containing the metadata is removed from
-// the tree.
-func getMeta(node *blackfriday.Node, unlink bool) (meta map[string]interface{}, werr error) {
+// getMeta finds and retrieves metadata from a parsed markdown tree,
+// decoding it using the given format. If unlink is true, the nodes
+// containing the metadata are removed from the tree.
+//
+// Metadata comments start with "meta". A comment starting with
+// "meta:name" is a named block, the contents of which are placed
+// under the key name in the returned map rather than at the top
+// level.
+func getMeta(node *blackfriday.Node, format string, unlink bool) (meta map[string]interface{}, werr error) {
 	var findComment func(*html.Node) (comment []byte, err error)
 	findComment = func(node *html.Node) (comment []byte, err error) {
 		if node.Type == html.CommentNode {
@@ -186,6 +646,10 @@ func getMeta(node *blackfriday.Node, unlink bool) (meta map[string]interface{},
 		return nil, nil
 	}
 
+	// Unlinking a node while walking the tree stops the walk, so the
+	// nodes are collected and unlinked afterwards instead.
+	var found []*blackfriday.Node
+
 	meta = make(map[string]interface{})
 	node.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
 		if !entering || (node.Type != blackfriday.HTMLBlock) {
@@ -203,34 +667,94 @@ func getMeta(node *blackfriday.Node, unlink bool) (meta map[string]interface{},
 			werr = fmt.Errorf("find comment: %w", err)
 			return blackfriday.Terminate
 		}
-		if !bytes.HasPrefix(comment, []byte("meta")) {
+		name, body, ok := splitMetaComment(comment)
+		if !ok {
 			return blackfriday.SkipChildren
 		}
 
-		if comment != nil {
-			err = yaml.Unmarshal(comment[4:], &meta)
-			if err != nil {
-				werr = fmt.Errorf("unmarshal: %w", err)
-				return blackfriday.Terminate
-			}
-
-			if unlink {
-				node.Unlink()
-			}
-
+		if name == "" {
+			err = decodeMeta(body, format, &meta)
+		} else {
+			block := make(map[string]interface{})
+			err = decodeMeta(body, format, &block)
+			meta[name] = block
+		}
+		if err != nil {
+			werr = fmt.Errorf("unmarshal: %w", err)
 			return blackfriday.Terminate
 		}
 
+		found = append(found, node)
 		return blackfriday.GoToNext
 	})
 
+	if unlink {
+		for _, node := range found {
+			node.Unlink()
+		}
+	}
+
 	return meta, werr
 }
 
+// splitMetaComment splits the text of a metadata comment into the
+// name of the block, if it has one, and the body of the block. If the
+// comment is not a metadata comment, ok is false.
+func splitMetaComment(comment []byte) (name string, body []byte, ok bool) {
+	if !bytes.HasPrefix(comment, []byte("meta")) {
+		return "", nil, false
+	}
+	rest := comment[4:]
+
+	if !bytes.HasPrefix(rest, []byte(":")) {
+		if (len(rest) > 0) && !unicode.IsSpace(rune(rest[0])) {
+			return "", nil, false
+		}
+		return "", rest, true
+	}
+
+	rest = rest[1:]
+	end := bytes.IndexFunc(rest, unicode.IsSpace)
+	if end < 0 {
+		end = len(rest)
+	}
+	if end == 0 {
+		return "", nil, false
+	}
+	return string(rest[:end]), rest[end:], true
+}
+
 // pageConfig contains a configuration for a page for manipulation by
 // a PageOption.
 type pageConfig struct {
-	Style string
+	Style              string
+	ContentTemplate    bool
+	ExpandEnv          bool
+	MetaFormat         string
+	Funcs              template.FuncMap
+	SidecarWins        bool
+	Defaults           map[string]interface{}
+	SourceDir          string
+	Outputs            []string
+	Extensions         blackfriday.Extensions
+	HTMLFlags          blackfriday.HTMLFlags
+	LinkFlags          blackfriday.HTMLFlags
+	Anchors            bool
+	LineNumbers        bool
+	LineNumbersInTable bool
+	HighlightClasses   bool
+	WordsPerMinute     int
+	Strict             bool
+	MissingKey         string
+}
+
+// chromaOptions returns the options for Chroma's HTML formatter.
+func (config *pageConfig) chromaOptions() []chromahtml.Option {
+	return []chromahtml.Option{
+		chromahtml.WithLineNumbers(config.LineNumbers),
+		chromahtml.LineNumbersInTable(config.LineNumbersInTable),
+		chromahtml.WithClasses(config.HighlightClasses),
+	}
 }
 
 // A PageOption is a function that provides optional configuration
@@ -238,9 +762,177 @@ type pageConfig struct {
 type PageOption func(*pageConfig)
 
 // WithStyle returns a PageOption that sets the rendering style to be
-// used by Chroma.
+// used by Chroma. A page's "hlstyle" metadata overrides it, and must
+// name one of Chroma's styles.
 func WithStyle(style string) PageOption {
 	return func(config *pageConfig) {
 		config.Style = style
 	}
 }
+
+// WithStrict returns a PageOption that determines whether problems
+// with a page that are otherwise ignored are errors. In strict mode,
+// metadata that bog uses must have the types that it expects, the
+// title must not be blank, and the content template fails if it refers
+// to a key that's missing from a map, unless WithMissingKey says
+// otherwise. It defaults to false.
+func WithStrict(strict bool) PageOption {
+	return func(config *pageConfig) {
+		config.Strict = strict
+	}
+}
+
+// WithMissingKey returns a PageOption that sets the missingkey option
+// of the content templates of pages, which determines what happens
+// when they refer to a key that's missing from a map. It may be
+// "default", "zero", or "error", as described in the documentation
+// for text/template, and defaults to "default".
+func WithMissingKey(mode string) PageOption {
+	return func(config *pageConfig) {
+		config.MissingKey = mode
+	}
+}
+
+// missingKey returns the value of the missingkey option for the
+// content templates of pages.
+func (config *pageConfig) missingKey() string {
+	return missingKeyMode(config.MissingKey, config.Strict)
+}
+
+// WithContentTemplate returns a PageOption that determines whether or
+// not the rendered markdown of a page is itself executed as a
+// template. It defaults to true.
+func WithContentTemplate(enabled bool) PageOption {
+	return func(config *pageConfig) {
+		config.ContentTemplate = enabled
+	}
+}
+
+// WithExpandEnv returns a PageOption that determines whether or not
+// environment variable references in string metadata values are
+// expanded.
+func WithExpandEnv(expand bool) PageOption {
+	return func(config *pageConfig) {
+		config.ExpandEnv = expand
+	}
+}
+
+// WithMetaFormat returns a PageOption that sets the format of the
+// body of metadata comments. It can be "yaml", "json", or "auto", the
+// default, to detect the format from the body itself.
+func WithMetaFormat(format string) PageOption {
+	return func(config *pageConfig) {
+		config.MetaFormat = format
+	}
+}
+
+// WithFuncs returns a PageOption that sets the functions that are
+// available to the page's content template. It defaults to
+// tmplFuncs.
+func WithFuncs(funcs template.FuncMap) PageOption {
+	return func(config *pageConfig) {
+		config.Funcs = funcs
+	}
+}
+
+// WithSidecarWins returns a PageOption that determines whether the
+// metadata in a page's sidecar file, such as "post.md.yaml" for
+// "post.md", overrides the metadata in the page itself. It defaults
+// to false.
+func WithSidecarWins(wins bool) PageOption {
+	return func(config *pageConfig) {
+		config.SidecarWins = wins
+	}
+}
+
+// WithDefaults returns a PageOption that sets metadata that the page
+// has if it doesn't set the same keys itself, either directly or in
+// a sidecar file. Environment variables in defaults are not expanded,
+// so the caller should do so if needed.
+func WithDefaults(meta map[string]interface{}) PageOption {
+	return func(config *pageConfig) {
+		config.Defaults = meta
+	}
+}
+
+// WithSourceDir returns a PageOption that sets the directory that the
+// page's source path is relative to. Pages whose sources are in
+// subdirectories of it output into the same subdirectories of the
+// output directory unless they set "outdir" in their metadata.
+func WithSourceDir(dir string) PageOption {
+	return func(config *pageConfig) {
+		config.SourceDir = dir
+	}
+}
+
+// WithOutputs returns a PageOption that sets the formats that the
+// page is output in if it doesn't list any in its metadata.
+func WithOutputs(formats []string) PageOption {
+	return func(config *pageConfig) {
+		config.Outputs = formats
+	}
+}
+
+// WithExtensions returns a PageOption that sets the blackfriday
+// extensions that the page's markdown is parsed with, which may
+// include markdown.TaskLists. It defaults to
+// blackfriday.CommonExtensions with task lists.
+func WithExtensions(ext blackfriday.Extensions) PageOption {
+	return func(config *pageConfig) {
+		config.Extensions = ext
+	}
+}
+
+// WithLinkFlags returns a PageOption that sets link-related HTML
+// renderer flags, such as blackfriday.NoopenerLinks, that are applied
+// to links to external URLs, including those produced by
+// autolinking.
+func WithLinkFlags(flags blackfriday.HTMLFlags) PageOption {
+	return func(config *pageConfig) {
+		config.LinkFlags = flags
+	}
+}
+
+// WithAnchors returns a PageOption that determines whether or not a
+// link to each heading is added next to it. A page's "anchors"
+// metadata overrides it.
+func WithAnchors(enabled bool) PageOption {
+	return func(config *pageConfig) {
+		config.Anchors = enabled
+	}
+}
+
+// WithLineNumbers returns a PageOption that determines whether or not
+// highlighted code blocks have line numbers. It defaults to false.
+func WithLineNumbers(enabled bool) PageOption {
+	return func(config *pageConfig) {
+		config.LineNumbers = enabled
+	}
+}
+
+// WithLineNumbersInTable returns a PageOption that determines whether
+// or not line numbers, if enabled, are put in a separate table column
+// from the code so that the code can be copied without them.
+func WithLineNumbersInTable(enabled bool) PageOption {
+	return func(config *pageConfig) {
+		config.LineNumbersInTable = enabled
+	}
+}
+
+// WithHighlightClasses returns a PageOption that determines whether
+// highlighted code is styled with CSS classes, which need a separate
+// stylesheet, instead of inline styles.
+func WithHighlightClasses(enabled bool) PageOption {
+	return func(config *pageConfig) {
+		config.HighlightClasses = enabled
+	}
+}
+
+// WithWordsPerMinute returns a PageOption that sets the reading speed
+// that the page's "readingtime" metadata, in minutes, is estimated
+// with. It defaults to 200.
+func WithWordsPerMinute(wpm int) PageOption {
+	return func(config *pageConfig) {
+		config.WordsPerMinute = wpm
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// writePage writes a page with the given content to a file in a new
+// temporary directory and returns its path.
+func writePage(tb testing.TB, content string) string {
+	tb.Helper()
+
+	path := filepath.Join(tb.TempDir(), "page.md")
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestContentTemplate(t *testing.T) {
+	const src = "# Title\n\nUse `{{.Name}}` in {{.Page.Meta.title}}.\n"
+	tests := []struct {
+		name    string
+		src     string
+		enabled bool
+		want    string
+	}{
+		{
+			name:    "Disabled",
+			src:     src,
+			enabled: false,
+			want:    "<p>Use <code>{{.Name}}</code> in {{.Page.Meta.title}}.</p>",
+		},
+		{
+			name:    "Enabled",
+			src:     "<!--meta\ntitle: Page\n-->\n# Title\n\nIn {{.Page.Meta.title}}.\n",
+			enabled: true,
+			want:    "<p>In Page.</p>",
+		},
+		{
+			name:    "EnabledByMeta",
+			src:     "<!--meta\ntitle: Page\ntemplate:\n  enabled: true\n-->\n# Title\n\nIn {{.Page.Meta.title}}.\n",
+			enabled: false,
+			want:    "<p>In Page.</p>",
+		},
+		{
+			name:    "DisabledByMeta",
+			src:     "<!--meta\ntemplate:\n  enabled: false\n-->\n" + src,
+			enabled: true,
+			want:    "<p>Use <code>{{.Name}}</code> in {{.Page.Meta.title}}.</p>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := LoadPage(writePage(t, test.src), nil, WithContentTemplate(test.enabled))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(page.Content, test.want) {
+				t.Errorf("content doesn't contain %q:\n%v", test.want, page.Content)
+			}
+		})
+	}
+}
+
+func BenchmarkLoadPage(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("<!--meta\ntitle: Benchmark\n-->\n")
+	for i := 0; i < 50; i++ {
+		sb.WriteString("## Section\n\nSome *text* with a [link](other.html) and `code`.\n\n```go\nfmt.Println(\"Hello\")\n```\n\n")
+	}
+	path := writePage(b, sb.String())
+
+	for _, enabled := range []bool{true, false} {
+		name := "content-template"
+		if !enabled {
+			name = "no-content-template"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := LoadPage(path, nil, WithContentTemplate(enabled))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestUnescapeActions(t *testing.T) {
+	tests := []struct {
+		content     string
+		left, right string
+		want        string
+	}{
+		{
+			content: `<a href="{{ref &quot;a.md&quot;}}">&quot;a&quot;</a>`,
+			left:    "{{",
+			want:    `<a href="{{ref "a.md"}}">&quot;a&quot;</a>`,
+		},
+		{
+			content: `&ldquo;x&rdquo; {{eq &ldquo;a&amp;b&rdquo; .X}} &amp; {{.Y}}`,
+			left:    "{{",
+			want:    `&ldquo;x&rdquo; {{eq "a&b" .X}} &amp; {{.Y}}`,
+		},
+		{
+			content: `[[printf &quot;%v&quot; 1]] {{&quot;}}`,
+			left:    "[[",
+			right:   "]]",
+			want:    `[[printf "%v" 1]] {{&quot;}}`,
+		},
+		{
+			content: `{{&quot;unclosed`,
+			left:    "{{",
+			want:    `{{&quot;unclosed`,
+		},
+	}
+
+	for _, test := range tests {
+		got := unescapeActions(test.content, test.left, test.right)
+		if got != test.want {
+			t.Errorf("%q:\ngot  %q\nwant %q", test.content, got, test.want)
+		}
+	}
+}
+
+func TestLoadPageMetaFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		format string
+		want   string
+		err    string
+	}{
+		{
+			name:   "AutoYAML",
+			src:    "<!--meta\ntitle: YAML\n-->\nText.\n",
+			format: metaAuto,
+			want:   "YAML",
+		},
+		{
+			name:   "AutoJSON",
+			src:    "<!--meta\n{\"title\": \"JSON\"}\n-->\nText.\n",
+			format: metaAuto,
+			want:   "JSON",
+		},
+		{
+			name:   "JSON",
+			src:    "<!--meta\n  {\"title\": \"JSON\", \"tags\": [\"a\"]}\n-->\nText.\n",
+			format: metaJSON,
+			want:   "JSON",
+		},
+		{
+			name:   "YAMLAsYAML",
+			src:    "<!--meta\ntitle: YAML\n-->\nText.\n",
+			format: metaYAML,
+			want:   "YAML",
+		},
+		{
+			name:   "YAMLAsJSON",
+			src:    "<!--meta\ntitle: YAML\n-->\nText.\n",
+			format: metaJSON,
+			err:    "invalid character",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := LoadPage(writePage(t, test.src), nil, WithMetaFormat(test.format))
+			if test.err != "" {
+				if (err == nil) || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := page.Meta["title"]; got != test.want {
+				t.Errorf("title is %q, not %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadPageSidecar(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		sidecar string
+		wins    bool
+		want    map[string]interface{}
+	}{
+		{
+			name:    "SidecarOnly",
+			src:     "Text.\n",
+			sidecar: "title: Sidecar\n",
+			want:    map[string]interface{}{"title": "Sidecar"},
+		},
+		{
+			name: "InFileOnly",
+			src:  "<!--meta\ntitle: In File\n-->\nText.\n",
+			want: map[string]interface{}{"title": "In File"},
+		},
+		{
+			name:    "Both",
+			src:     "<!--meta\ntitle: In File\n-->\nText.\n",
+			sidecar: "title: Sidecar\nauthor: Someone\n",
+			want:    map[string]interface{}{"title": "In File", "author": "Someone"},
+		},
+		{
+			name:    "BothSidecarWins",
+			src:     "<!--meta\ntitle: In File\n-->\nText.\n",
+			sidecar: "title: Sidecar\nauthor: Someone\n",
+			wins:    true,
+			want:    map[string]interface{}{"title": "Sidecar", "author": "Someone"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writePage(t, test.src)
+			if test.sidecar != "" {
+				err := ioutil.WriteFile(path+".yaml", []byte(test.sidecar), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			page, err := LoadPage(path, nil, WithSidecarWins(test.wins))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, want := range test.want {
+				if got := page.Meta[k]; got != want {
+					t.Errorf("%v is %q, not %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestContentTemplateName checks that a page's content template can
+// define and use a template named "content" without colliding with
+// itself or with the page templates.
+func TestContentTemplateName(t *testing.T) {
+	src := "Before {{define \"content\"}}inner{{end}}{{template \"content\"}} after.\n"
+	page, err := LoadPage(writePage(t, src), nil, WithContentTemplate(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>Before inner after.</p>"; !strings.Contains(page.Content, want) {
+		t.Errorf("content doesn't contain %q:\n%v", want, page.Content)
+	}
+}
+
+func TestLoadPageNamedMeta(t *testing.T) {
+	src := `<!--meta
+title: Page
+-->
+<!--meta:seo
+description: A page.
+keywords: [a, b]
+-->
+# Heading
+
+<!--meta:layout
+{"sidebar": true}
+-->
+Text.
+`
+	page, err := LoadPage(writePage(t, src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := page.Meta["title"]; got != "Page" {
+		t.Errorf("title is %q", got)
+	}
+	seo, _ := page.Meta["seo"].(map[string]interface{})
+	if got := seo["description"]; got != "A page." {
+		t.Errorf("seo.description is %q", got)
+	}
+	layout, _ := page.Meta["layout"].(map[string]interface{})
+	if got := layout["sidebar"]; got != true {
+		t.Errorf("layout.sidebar is %v", got)
+	}
+	if strings.Contains(page.Content, "meta") {
+		t.Errorf("metadata comments weren't removed:\n%v", page.Content)
+	}
+}
+
+func TestLoadPageAutolink(t *testing.T) {
+	const src = "Visit https://example.com/ or [the docs](docs.html).\n"
+	tests := []struct {
+		name  string
+		ext   blackfriday.Extensions
+		flags blackfriday.HTMLFlags
+		want  string
+	}{
+		{
+			name: "Default",
+			ext:  blackfriday.CommonExtensions,
+			want: `<a href="https://example.com/">https://example.com/</a>`,
+		},
+		{
+			name:  "Attributes",
+			ext:   blackfriday.CommonExtensions,
+			flags: blackfriday.NoopenerLinks | blackfriday.NoreferrerLinks | blackfriday.HrefTargetBlank,
+			want:  `<a href="https://example.com/" target="_blank" rel="noreferrer noopener">https://example.com/</a>`,
+		},
+		{
+			name:  "Disabled",
+			ext:   blackfriday.CommonExtensions &^ blackfriday.Autolink,
+			flags: blackfriday.NoopenerLinks,
+			want:  "Visit https://example.com/ or",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := LoadPage(writePage(t, src), nil, WithExtensions(test.ext), WithLinkFlags(test.flags))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(page.Content, test.want) {
+				t.Errorf("content doesn't contain %q:\n%v", test.want, page.Content)
+			}
+			if want := `<a href="docs.html">the docs</a>`; !strings.Contains(page.Content, want) {
+				t.Errorf("relative link was changed:\n%v", page.Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Pagination describes where a single page of a paginated index is
+// in relation to the others. It is available to the index template
+// as .Pagination when the index is paginated.
+type Pagination struct {
+	// Page is the number of the current page, starting from 1.
+	Page int
+
+	// Total is the total number of pages.
+	Total int
+
+	// Prev and Next are links, relative to the current page, to the
+	// previous and next pages. They are empty if there are no such
+	// pages.
+	Prev, Next string
+}
+
+// indexPage is a single page of the index.
+type indexPage struct {
+	// Path is the slash-separated path of the page's output relative
+	// to the output directory.
+	Path string
+
+	// Section is the slash-separated output subdirectory whose pages
+	// the page lists with -sectionindex, or an empty string for the
+	// root index.
+	Section string
+
+	Pages      []*PageInfo
+	Pagination *Pagination
+}
+
+// paginate splits pages into pages of the index with at most perPage
+// pages each. The first is output to index.html and the rest to
+// pagePath formatted with the page's number. If perPage is not
+// positive, a single page containing all of pages is returned without
+// any pagination information.
+func paginate(pages []*PageInfo, perPage int, pagePath string) ([]indexPage, error) {
+	if perPage <= 0 {
+		return []indexPage{{Path: "index.html", Pages: pages}}, nil
+	}
+
+	pathOf := func(n int) string {
+		if n == 1 {
+			return "index.html"
+		}
+		return path.Clean(fmt.Sprintf(pagePath, n))
+	}
+	if pathOf(2) == pathOf(3) {
+		return nil, fmt.Errorf("index page path %q does not contain the page number", pagePath)
+	}
+	if !isLocal(pathOf(2)) {
+		return nil, fmt.Errorf("index page path %q is outside of the output root", pagePath)
+	}
+
+	total := (len(pages) + perPage - 1) / perPage
+	if total == 0 {
+		total = 1
+	}
+
+	index := make([]indexPage, 0, total)
+	for n := 1; n <= total; n++ {
+		start, end := (n-1)*perPage, n*perPage
+		if end > len(pages) {
+			end = len(pages)
+		}
+
+		p := pathOf(n)
+		pagination := Pagination{Page: n, Total: total}
+		if n > 1 {
+			pagination.Prev = relLink(p, pathOf(n-1))
+		}
+		if n < total {
+			pagination.Next = relLink(p, pathOf(n+1))
+		}
+
+		index = append(index, indexPage{
+			Path:       p,
+			Pages:      pages[start:end],
+			Pagination: &pagination,
+		})
+	}
+
+	return index, nil
+}
+
+// relLink returns a link from the page at the slash-separated path
+// from to the one at to, both relative to the same directory.
+func relLink(from, to string) string {
+	fromDir := splitDir(path.Dir(from))
+	toDir := splitDir(path.Dir(to))
+	for (len(fromDir) > 0) && (len(toDir) > 0) && (fromDir[0] == toDir[0]) {
+		fromDir, toDir = fromDir[1:], toDir[1:]
+	}
+
+	link := path.Base(to)
+	if len(toDir) > 0 {
+		link = path.Join(append(toDir, link)...)
+	}
+	return strings.Repeat("../", len(fromDir)) + link
+}
+
+// rootLink returns a link from the page at the slash-separated path p
+// to the directory that it is relative to, ending in a slash. For
+// pages directly in that directory, it is empty.
+func rootLink(p string) string {
+	return strings.Repeat("../", len(splitDir(path.Dir(p))))
+}
+
+// splitDir splits a slash-separated directory into its elements,
+// returning nil for ".".
+func splitDir(dir string) []string {
+	if dir == "." {
+		return nil
+	}
+	return strings.Split(dir, "/")
+}
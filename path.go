@@ -1,9 +1,19 @@
 package main
 
-import "path/filepath"
+import (
+	"path/filepath"
+	"strings"
+)
 
 // RemoveExt removes any extensions from the path provided.
 func RemoveExt(path string) string {
 	ext := filepath.Ext(path)
 	return path[:len(path)-len(ext)]
 }
+
+// IsHidden returns true if the final element of path names a hidden
+// file or directory, meaning that it begins with a dot.
+func IsHidden(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") && (name != ".") && (name != "..")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// An OutputProcessor transforms the contents of a generated file
+// before it is written to disk. path is the path that the file will
+// be written to, which processors can use to decide whether or not
+// to modify a given file.
+type OutputProcessor interface {
+	Process(path string, content []byte) ([]byte, error)
+}
+
+// OutputProcessorFunc is a function that implements OutputProcessor.
+type OutputProcessorFunc func(path string, content []byte) ([]byte, error)
+
+// Process calls f(path, content).
+func (f OutputProcessorFunc) Process(path string, content []byte) ([]byte, error) {
+	return f(path, content)
+}
+
+// processorChain is an OutputProcessor that runs each of its
+// processors in order, passing the output of each into the next.
+type processorChain []OutputProcessor
+
+func (c processorChain) Process(path string, content []byte) ([]byte, error) {
+	for _, p := range c {
+		var err error
+		content, err = p.Process(path, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// writeOutput passes content through the processor chain and writes
+// the result to the file at path, creating any necessary parent
+// directories. It returns the content that was actually written.
+func writeOutput(path string, content []byte, chain processorChain) ([]byte, error) {
+	content, err := chain.Process(path, content)
+	if err != nil {
+		return nil, fmt.Errorf("process: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return content, ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessorChain(t *testing.T) {
+	var order []string
+	appender := func(name string) OutputProcessor {
+		return OutputProcessorFunc(func(path string, content []byte) ([]byte, error) {
+			order = append(order, name+":"+filepath.Base(path))
+			return append(content, name...), nil
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "sub", "page.html")
+	chain := processorChain{appender("a"), appender("b")}
+	written, err := writeOutput(path, []byte("x"), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(written), "xab"; got != want {
+		t.Errorf("wrote %q, not %q", got, want)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, written) {
+		t.Errorf("file contains %q, not %q", content, written)
+	}
+	if got, want := fmt.Sprint(order), "[a:page.html b:page.html]"; got != want {
+		t.Errorf("processors ran as %v, not %v", got, want)
+	}
+
+	errFail := errors.New("fail")
+	order = nil
+	chain = processorChain{
+		OutputProcessorFunc(func(string, []byte) ([]byte, error) { return nil, errFail }),
+		appender("b"),
+	}
+	_, err = chain.Process("page.html", []byte("x"))
+	if !errors.Is(err, errFail) {
+		t.Errorf("got error %v, not %v", err, errFail)
+	}
+	if len(order) != 0 {
+		t.Errorf("processors after a failure ran: %v", order)
+	}
+}
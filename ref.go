@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// refPattern matches the placeholders produced by the ref template
+// function. The placeholder contains the slash-separated path of the
+// referenced source relative to the source directory.
+var refPattern = regexp.MustCompile("\x00ref:([^\x00]*)\x00")
+
+// refPlaceholder returns the placeholder for a reference to the
+// source at the slash-separated path rel.
+func refPlaceholder(rel string) string {
+	return "\x00ref:" + rel + "\x00"
+}
+
+// sourceKey returns the slash-separated path of the source at p
+// relative to the source directory, which is how ref refers to it.
+func (s *Site) sourceKey(p string) (string, error) {
+	rel, err := filepath.Rel(s.flags.Source, p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// ref is a template function that returns a link to the output of the
+// page generated from the source at src, which is relative to the
+// source directory. It returns an error if there is no such source.
+//
+// Pages' outputs aren't known until all of them are loaded, but ref
+// may be used in the content of pages, so it returns a placeholder
+// that refProcessor replaces when the file that it ends up in is
+// written. The link is relative to that file, so it works no matter
+// which page, index, or feed the content is included in.
+func (s *Site) ref(src string) (string, error) {
+	rel := path.Clean("/" + filepath.ToSlash(src))[1:]
+	if _, ok := s.sourceKeys[rel]; !ok {
+		return "", fmt.Errorf("ref %q: no such source", src)
+	}
+	return refPlaceholder(rel), nil
+}
+
+// refProcessor is an OutputProcessor that replaces the placeholders
+// produced by ref with links from the file being written to the pages
+// that they refer to. It returns an error if a referenced page isn't
+// published.
+func (s *Site) refProcessor(p string, content []byte) ([]byte, error) {
+	if !bytes.Contains(content, []byte("\x00ref:")) {
+		return content, nil
+	}
+
+	from, err := filepath.Rel(s.flags.Output, p)
+	if err != nil {
+		return nil, err
+	}
+	from = filepath.ToSlash(from)
+
+	var rerr error
+	content = refPattern.ReplaceAllFunc(content, func(m []byte) []byte {
+		rel := string(refPattern.FindSubmatch(m)[1])
+		page, ok := s.bySource[rel]
+		if !ok {
+			if rerr == nil {
+				rerr = fmt.Errorf("ref %q: page is not published", rel)
+			}
+			return nil
+		}
+
+		format := "html"
+		if !page.hasOutput(format) {
+			format = page.Outputs()[0]
+		}
+		return []byte(relLink(from, page.OutputFormat(format)))
+	})
+	return content, rerr
+}
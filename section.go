@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/DeedleFake/bog/multierr"
+)
+
+// Modes for the root index with -sectionindex.
+const (
+	rootIndexAll  = "all"
+	rootIndexRoot = "root"
+)
+
+// sections groups pages by the output subdirectories that they output
+// directly into. Pages in the root of the output directory are left
+// out, as are directories that only contain other directories. Pages
+// keep their relative order.
+func sections(pages []*PageInfo) map[string][]*PageInfo {
+	sections := make(map[string][]*PageInfo)
+	for _, page := range pages {
+		dir := page.OutputDir()
+		if dir == "" {
+			continue
+		}
+		sections[dir] = append(sections[dir], page)
+	}
+	return sections
+}
+
+// rootIndexPages returns the pages that the root index should list.
+// With -sectionindex and a -root-index of "root", that is only the
+// pages in the root of the output directory. Otherwise, it is every
+// listed page.
+func (s *Site) rootIndexPages() ([]*PageInfo, error) {
+	if !s.flags.Sections {
+		return s.listed, nil
+	}
+
+	switch s.flags.RootIdx {
+	case rootIndexAll:
+		return s.listed, nil
+
+	case rootIndexRoot:
+		var pages []*PageInfo
+		for _, page := range s.listed {
+			if page.OutputDir() == "" {
+				pages = append(pages, page)
+			}
+		}
+		return pages, nil
+
+	default:
+		return nil, fmt.Errorf("unknown root index mode %q", s.flags.RootIdx)
+	}
+}
+
+// generateSectionIndexes starts generating an index, paginated in the
+// same way as the root index, in every output subdirectory that pages
+// output directly into, listing only those pages. Directories in which
+// a page already outputs to index.html are skipped.
+func (s *Site) generateSectionIndexes(eg *multierr.MultiErr) error {
+	taken := make(map[string]struct{})
+	for _, page := range s.pages {
+		for _, format := range page.Outputs() {
+			taken[page.OutputFormat(format)] = struct{}{}
+		}
+	}
+
+	groups := sections(s.listed)
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	src := s.flags.SectTmpl
+	if src == "" {
+		src = s.flags.Index
+	}
+
+	for _, dir := range dirs {
+		if _, ok := taken[path.Join(dir, "index.html")]; ok {
+			continue
+		}
+
+		index, err := paginate(groups[dir], s.flags.PerPage, s.flags.PagePath)
+		if err != nil {
+			return fmt.Errorf("paginate index of %q: %w", dir, err)
+		}
+
+		for _, ip := range index {
+			ip := ip
+			ip.Path = path.Join(dir, ip.Path)
+			ip.Section = dir
+			eg.Go(func() error {
+				path := filepath.Join(s.flags.Output, filepath.FromSlash(ip.Path))
+				err := s.writeFile(output{Path: path, ModTime: s.lastModified(), Sources: nonEmpty(src), Page: true}, func(w io.Writer) error {
+					return genIndex(w, ip, s.collections, s.sectionTmpl, s.data)
+				})
+				if err != nil {
+					return fmt.Errorf("generate index of %q: %w", dir, err)
+				}
+
+				infof("Generated %q", path)
+				return nil
+			})
+		}
+	}
+
+	return nil
+}
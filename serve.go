@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// reloadPath is the path that the live-reload script connects to.
+	reloadPath = "/_bog/reload"
+
+	// reloadScript is injected into served HTML pages so that they
+	// reload whenever the site is rebuilt.
+	reloadScript = `<script>(function() {
+	var ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "` + reloadPath + `");
+	ws.onmessage = function() { location.reload(); };
+})();</script>`
+
+	// rebuildDelay is how long to wait after a change for further
+	// changes before rebuilding, so that saving several files at once
+	// only causes a single rebuild.
+	rebuildDelay = 100 * time.Millisecond
+)
+
+// serve builds the site, serves the output directory over HTTP at
+// addr, and rebuilds the site whenever its sources, templates, data,
+// or config file change, until ctx is canceled. Before each rebuild,
+// reload, if it isn't nil, is called to get the flags again so that
+// changes to the config file take effect, though the server keeps
+// serving the original output directory. Pages being viewed in a
+// browser are reloaded after each successful rebuild.
+//
+// A failed build, including the first one, is reported but doesn't
+// stop the server. Builds write directly into the output directory,
+// so a build that fails while generating output can leave a mix of
+// old and new files, which are served as they are until the next
+// successful build. Failures while loading the site, such as bad
+// metadata or templates, happen before anything is written, and leave
+// the previous output alone.
+func serve(ctx context.Context, flags flags, addr string, reload func() (flags, error)) error {
+	if flags.Output == "" {
+		flags.Output = flags.Source
+	}
+
+	b := builder{flags: flags}
+	err := b.build(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		printBuildError(flags.ErrorFormat, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	err = b.watch(watcher)
+	if err != nil {
+		warnf("watch: %v", err)
+	}
+
+	var r reloader
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, websocket.Handler(r.serve))
+	mux.Handle("/", liveHandler(flags.Output))
+
+	srv := http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- srv.ListenAndServe()
+	}()
+	infof("Serving %q at %v", flags.Output, addr)
+
+	var rebuild <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			srv.Shutdown(context.Background())
+			return nil
+
+		case err := <-srvErr:
+			return fmt.Errorf("serve: %w", err)
+
+		case ev := <-watcher.Events:
+			if b.ignored(ev.Name) {
+				continue
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					err := b.watchTree(watcher, ev.Name)
+					if err != nil {
+						warnf("watch %q: %v", ev.Name, err)
+					}
+				}
+			}
+			rebuild = time.After(rebuildDelay)
+
+		case err := <-watcher.Errors:
+			warnf("watch: %v", err)
+
+		case <-rebuild:
+			rebuild = nil
+
+			if reload != nil {
+				next, err := reload()
+				if err != nil {
+					printBuildError(b.flags.ErrorFormat, err)
+					continue
+				}
+				if next.Output == "" {
+					next.Output = next.Source
+				}
+				b.flags = next
+
+				err = b.watch(watcher)
+				if err != nil {
+					warnf("watch: %v", err)
+				}
+			}
+
+			err := b.build(ctx)
+			if err != nil {
+				printBuildError(b.flags.ErrorFormat, err)
+				continue
+			}
+			r.reload()
+		}
+	}
+}
+
+// printBuildError prints an error returned by Site.Build to stderr in
+// the given format.
+func printBuildError(format string, err error) {
+	var serr *StageError
+	if errors.As(err, &serr) {
+		printErrors(logErrs, format, serr.Stage, serr.Errs)
+		return
+	}
+	printErrors(logErrs, format, "", []error{err})
+}
+
+// builder builds a site repeatedly and keeps track of the outputs of
+// the latest build so that changes to them don't trigger another one.
+type builder struct {
+	flags flags
+
+	m       sync.Mutex
+	outputs map[string]struct{}
+}
+
+// build builds the site from scratch, overwriting any existing
+// output in place. If the build fails, whatever it had already
+// written is left where it is.
+func (b *builder) build(ctx context.Context) error {
+	site := NewSite(b.flags)
+	err := site.Build(ctx)
+
+	outputs := make(map[string]struct{}, len(site.outputs))
+	for _, o := range site.outputs {
+		outputs[filepath.Clean(o.Path)] = struct{}{}
+	}
+	if b.flags.Manifest != "" {
+		outputs[filepath.Clean(site.manifestPath())] = struct{}{}
+	}
+	if b.flags.Headers != "" {
+		outputs[filepath.Join(b.flags.Output, b.flags.Headers)] = struct{}{}
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.outputs = outputs
+
+	return err
+}
+
+// ignored returns true if a change to the file at p should not cause a
+// rebuild, either because it was written by the latest build or
+// because it is in the output directory and the output directory is
+// separate from the source directory.
+func (b *builder) ignored(p string) bool {
+	p = filepath.Clean(p)
+
+	b.m.Lock()
+	_, ok := b.outputs[p]
+	b.m.Unlock()
+	if ok {
+		return true
+	}
+
+	if IsHidden(filepath.Base(p)) && !b.flags.IncludeHidden {
+		return true
+	}
+
+	out, _ := filepath.Abs(b.flags.Output)
+	src, _ := filepath.Abs(b.flags.Source)
+	abs, _ := filepath.Abs(p)
+	if out == src {
+		return false
+	}
+	return (abs == out) || strings.HasPrefix(abs, out+string(filepath.Separator))
+}
+
+// watch adds the source tree and the directories containing the
+// site's templates and data files to watcher. Directories are watched
+// rather than the files themselves so that editors that save by
+// replacing files don't break the watch.
+func (b *builder) watch(watcher *fsnotify.Watcher) error {
+	err := b.watchTree(watcher, b.flags.Source)
+	if err != nil {
+		return err
+	}
+
+	files := []string{
+		b.flags.Page,
+		b.flags.TextPage,
+		b.flags.GemPage,
+		b.flags.Index,
+		b.flags.DirTmpl,
+		b.flags.SectTmpl,
+		b.flags.TagTmpl,
+		b.flags.PageDefaults,
+	}
+	files = append(files, b.flags.Data...)
+	for src := range b.flags.Extras {
+		files = append(files, src)
+	}
+	for _, tmpl := range b.flags.ExtPages {
+		files = append(files, tmpl)
+	}
+
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		err := watcher.Add(filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.flags.Static != "" {
+		err := b.watchTree(watcher, b.flags.Static)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{b.flags.PagesDir, b.flags.Layouts} {
+		if dir == "" {
+			continue
+		}
+		err := watcher.Add(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// watchTree adds root and all of its subdirectories, except for
+// hidden ones and the output directory, to watcher.
+func (b *builder) watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if (p != root) && b.ignored(p) {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(p)
+	})
+}
+
+// reloader tells connected live-reload scripts to reload their pages.
+type reloader struct {
+	m       sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+// serve handles a websocket connection from a live-reload script.
+func (r *reloader) serve(ws *websocket.Conn) {
+	defer ws.Close()
+
+	c := make(chan struct{}, 1)
+	r.m.Lock()
+	if r.clients == nil {
+		r.clients = make(map[chan struct{}]struct{})
+	}
+	r.clients[c] = struct{}{}
+	r.m.Unlock()
+
+	defer func() {
+		r.m.Lock()
+		defer r.m.Unlock()
+		delete(r.clients, c)
+	}()
+
+	// The script never sends anything, so reading only finishes when
+	// the connection is closed.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+
+	select {
+	case <-c:
+		websocket.Message.Send(ws, "reload")
+	case <-closed:
+	}
+}
+
+// reload tells all of the connected scripts to reload.
+func (r *reloader) reload() {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for c := range r.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// liveHandler returns a handler that serves files from root, injecting
+// the live-reload script into HTML pages.
+func liveHandler(root string) http.Handler {
+	files := http.FileServer(http.Dir(root))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := req.URL.Path
+		if strings.HasSuffix(p, "/") {
+			p += "index.html"
+		}
+		if !strings.EqualFold(path.Ext(p), ".html") {
+			files.ServeHTTP(w, req)
+			return
+		}
+
+		file := filepath.Join(root, filepath.FromSlash(path.Clean("/"+p)))
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			files.ServeHTTP(w, req)
+			return
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data = injectScript(data, reloadScript)
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, req, file, info.ModTime(), bytes.NewReader(data))
+	})
+}
+
+// injectScript inserts script before the closing body tag of an HTML
+// page, or at the end of it if it doesn't have one.
+func injectScript(page []byte, script string) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		return append(page, script...)
+	}
+
+	r := make([]byte, 0, len(page)+len(script))
+	r = append(r, page[:i]...)
+	r = append(r, script...)
+	return append(r, page[i:]...)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBuilderIgnored(t *testing.T) {
+	src := t.TempDir()
+	out := filepath.Join(src, "public")
+
+	tests := []struct {
+		name   string
+		flags  flags
+		path   string
+		ignore bool
+	}{
+		{"Source", flags{Source: src, Output: out}, filepath.Join(src, "post.md"), false},
+		{"Output", flags{Source: src, Output: out}, filepath.Join(out, "post.html"), true},
+		{"OutputDir", flags{Source: src, Output: out}, out, true},
+		{"OutputPrefix", flags{Source: src, Output: out}, out + "-old", false},
+		{"Hidden", flags{Source: src, Output: out}, filepath.Join(src, ".post.md.swp"), true},
+		{"IncludeHidden", flags{Source: src, Output: out, IncludeHidden: true}, filepath.Join(src, ".post.md.swp"), false},
+		{"SameDir", flags{Source: src, Output: src}, filepath.Join(src, "post.md"), false},
+		{"Generated", flags{Source: src, Output: src}, filepath.Join(src, "post.html"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := builder{
+				flags: test.flags,
+				outputs: map[string]struct{}{
+					filepath.Join(src, "post.html"): {},
+				},
+			}
+			if got := b.ignored(test.path); got != test.ignore {
+				t.Errorf("ignored(%q) = %v, want %v", test.path, got, test.ignore)
+			}
+		})
+	}
+}
+
+func TestInjectScript(t *testing.T) {
+	const script = "<script></script>"
+	tests := []struct {
+		page, want string
+	}{
+		{
+			page: "<html><body><p>Hi</p></body></html>",
+			want: "<html><body><p>Hi</p><script></script></body></html>",
+		},
+		{
+			page: "<HTML><BODY>Hi</BODY></HTML>",
+			want: "<HTML><BODY>Hi<script></script></BODY></HTML>",
+		},
+		{
+			page: "<body><pre>&lt;/body&gt; </body></pre></body>",
+			want: "<body><pre>&lt;/body&gt; </body></pre><script></script></body>",
+		},
+		{
+			page: "<p>No body</p>",
+			want: "<p>No body</p><script></script>",
+		},
+	}
+
+	for _, test := range tests {
+		got := string(injectScript([]byte(test.page), script))
+		if got != test.want {
+			t.Errorf("%q:\ngot  %q\nwant %q", test.page, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,1283 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/DeedleFake/bog/internal/bufpool"
+	"github.com/DeedleFake/bog/manifest"
+	"github.com/DeedleFake/bog/markdown"
+	"github.com/DeedleFake/bog/multierr"
+	"github.com/russross/blackfriday/v2"
+)
+
+// Site is a site that is built from a source directory into an output
+// directory.
+type Site struct {
+	flags flags
+	now   time.Time
+
+	data       interface{}
+	funcs      template.FuncMap
+	processors processorChain
+	extensions blackfriday.Extensions
+
+	outputs      []output
+	moutputs     sync.Mutex
+	pageTmpls    map[string]*template.Template
+	extTmpls     map[string]*template.Template
+	layoutTmpls  map[string]*template.Template
+	indexTmpl    *template.Template
+	dirTmpl      *template.Template
+	sectionTmpl  *template.Template
+	tagTmpl      *template.Template
+	extraTmpls   map[string]*template.Template
+	listTmpls    map[string]*template.Template
+	pages        []*PageInfo
+	listed       []*PageInfo
+	byID         map[string]*PageInfo
+	sourceKeys   map[string]struct{}
+	bySource     map[string]*PageInfo
+	collections  map[string][]*PageInfo
+	previous     map[string]manifest.File
+	reconfigured bool
+
+	stats buildStats
+}
+
+// buildStats counts the work done by a build. Its fields are updated
+// atomically, as they're modified while generating output concurrently.
+type buildStats struct {
+	// Pages is the number of page outputs that were generated.
+	Pages int64
+
+	// Extras is the number of files generated from the -extras and the
+	// templates in the -pages directory.
+	Extras int64
+
+	// Skipped is the number of pages that weren't published and page
+	// outputs that were already up to date.
+	Skipped int64
+}
+
+// Summary returns a single line describing the work done by the build,
+// which took d.
+func (s *Site) Summary(d time.Duration) string {
+	return fmt.Sprintf(
+		"Built %v pages, %v extras, skipped %v in %v",
+		atomic.LoadInt64(&s.stats.Pages),
+		atomic.LoadInt64(&s.stats.Extras),
+		atomic.LoadInt64(&s.stats.Skipped),
+		d.Round(time.Millisecond),
+	)
+}
+
+// NewSite returns a new site that will be built using the provided
+// configuration.
+func NewSite(flags flags) *Site {
+	if flags.Output == "" {
+		flags.Output = flags.Source
+	}
+
+	s := &Site{
+		flags:      flags,
+		now:        buildTime(),
+		extensions: blackfriday.CommonExtensions | markdown.TaskLists,
+	}
+	static, _ := s.staticDir()
+	s.funcs = mergeFuncs(tmplFuncs, template.FuncMap{
+		"bust":        bustFunc(static, flags.Source),
+		"content":     s.content,
+		"hlcss":       s.hlcss,
+		"markdownify": s.markdownify,
+		"ref":         s.ref,
+	})
+	s.AddProcessors(OutputProcessorFunc(s.refProcessor))
+	if flags.Minify {
+		s.AddProcessors(minifyProcessor)
+	}
+	return s
+}
+
+// AddProcessors appends processors to the chain that every generated
+// file is passed through before being written.
+func (s *Site) AddProcessors(processors ...OutputProcessor) {
+	s.processors = append(s.processors, processors...)
+}
+
+// Build loads the site's data, templates, and pages and then
+// generates its output. If one or more errors occur during either
+// loading the pages or generating the output, the returned error is
+// a *StageError. If the site is configured to keep going, errors
+// loading individual pages don't prevent the rest of the site from
+// being generated, but are still returned.
+func (s *Site) Build(ctx context.Context) error {
+	err := s.loadData()
+	if err != nil {
+		return err
+	}
+
+	sources, err := s.findSources()
+	if err != nil {
+		return err
+	}
+	s.sourceKeys = make(map[string]struct{}, len(sources))
+	for _, src := range sources {
+		key, err := s.sourceKey(src)
+		if err != nil {
+			return err
+		}
+		s.sourceKeys[key] = struct{}{}
+	}
+
+	err = checkFormats(s.flags.Formats)
+	if err != nil {
+		return err
+	}
+
+	s.extensions, err = s.markdownExtensions()
+	if err != nil {
+		return err
+	}
+
+	err = s.loadTemplates()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	loadErr := s.loadPages(ctx, sources)
+	if (loadErr != nil) && !s.flags.KeepGoing {
+		return loadErr
+	}
+	debugf("Loaded %v pages in %v", len(s.pages), time.Since(start))
+	s.pages = s.publishable(s.pages)
+
+	s.listed = make([]*PageInfo, 0, len(s.pages))
+	for _, page := range s.pages {
+		if page.Listed() {
+			s.listed = append(s.listed, page)
+		}
+	}
+	linkPages(s.listed)
+
+	err = checkOutputs(s.pages)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkLayouts()
+	if err != nil {
+		return err
+	}
+
+	s.byID = make(map[string]*PageInfo, len(s.pages))
+	s.bySource = make(map[string]*PageInfo, len(s.pages))
+	for _, page := range s.pages {
+		s.byID[page.ID()] = page
+
+		key, err := s.sourceKey(page.Path)
+		if err != nil {
+			return err
+		}
+		s.bySource[key] = page
+	}
+
+	err = s.collect()
+	if err != nil {
+		return err
+	}
+
+	start = time.Now()
+	err = s.generate(ctx)
+	if err != nil {
+		return err
+	}
+	debugf("Generated output in %v", time.Since(start))
+	return loadErr
+}
+
+// buildTime returns the time that the build should consider to be
+// the present. This is the current time unless the SOURCE_DATE_EPOCH
+// environment variable is set to a Unix timestamp, in which case that
+// is used instead to allow for reproducible builds.
+func buildTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return time.Now()
+}
+
+// loadData loads the template data from the data file, if there is
+// one, and applies any overrides to it.
+func (s *Site) loadData() error {
+	s.data = make(map[string]interface{})
+	for _, path := range s.flags.Data {
+		d, err := readDataFile(path)
+		if err != nil {
+			return fmt.Errorf("read %q: %w", path, err)
+		}
+		s.data = mergeData(s.data, d)
+	}
+	if s.flags.ExpandEnv {
+		s.data = expandEnv(s.data)
+	}
+	if len(s.flags.Set) > 0 {
+		d, err := setData(s.data, s.flags.Set)
+		if err != nil {
+			return fmt.Errorf("set data: %w", err)
+		}
+		s.data = d
+	}
+
+	return nil
+}
+
+// findSources returns the paths of the source files in the source
+// directory and all of its subdirectories, excluding any listed in a
+// .bogignore file. Each directory's .bogignore applies to the
+// directory and everything under it. Hidden directories are skipped
+// along with hidden files, as is the output directory if it is inside
+// of the source directory.
+func (s *Site) findSources() ([]string, error) {
+	ig := ignorer{root: s.flags.Source}
+	out, _ := filepath.Abs(s.flags.Output)
+	static, _ := s.staticDir()
+	static, _ = filepath.Abs(static)
+
+	var paths []string
+	err := filepath.Walk(s.flags.Source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.flags.Source, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if rel != "." {
+				if !s.flags.IncludeHidden && IsHidden(info.Name()) {
+					return filepath.SkipDir
+				}
+				if ig.Ignored(rel, true) {
+					return filepath.SkipDir
+				}
+				if abs, _ := filepath.Abs(p); (abs == out) || (abs == static) {
+					return filepath.SkipDir
+				}
+			}
+
+			if rel == "." {
+				rel = ""
+			}
+			err := ig.Load(rel)
+			if err != nil {
+				return fmt.Errorf("load %v: %w", path.Join(rel, ignoreFile), err)
+			}
+			return nil
+		}
+
+		if !s.flags.IncludeHidden && IsHidden(info.Name()) {
+			return nil
+		}
+		if ig.Ignored(rel, false) {
+			return nil
+		}
+		paths = append(paths, p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk source directory: %w", err)
+	}
+
+	sources, err := selectSources(paths, s.flags.Exts, s.flags.OnAmbiguous)
+	if err != nil {
+		return nil, fmt.Errorf("select sources: %w", err)
+	}
+	return sources, nil
+}
+
+// newTemplate returns a new template with the given name for use by
+// the site, with the site's functions and the missingkey option
+// selected with -missingkey.
+func (s *Site) newTemplate(name string) *template.Template {
+	return template.New(name).
+		Funcs(s.funcs).
+		Option("missingkey=" + missingKeyMode(s.flags.MissingKey, s.flags.Strict))
+}
+
+// loadTemplates loads the page, index, and extra templates.
+func (s *Site) loadTemplates() error {
+	pagePaths := map[string]string{
+		"html":    s.flags.Page,
+		"text":    s.flags.TextPage,
+		"gemtext": s.flags.GemPage,
+	}
+	s.pageTmpls = make(map[string]*template.Template, len(outputFormats))
+	for name, format := range outputFormats {
+		tmpl, err := loadTemplate(s.newTemplate("page"), format.Template, pagePaths[name])
+		if err != nil {
+			return fmt.Errorf("load %v page template: %w", name, err)
+		}
+		s.pageTmpls[name] = tmpl
+	}
+
+	s.extTmpls = make(map[string]*template.Template, len(s.flags.ExtPages))
+	for ext, path := range s.flags.ExtPages {
+		tmpl, err := loadTemplate(s.newTemplate("page"), "", path)
+		if err != nil {
+			return fmt.Errorf("load page template for %v: %w", ext, err)
+		}
+		s.extTmpls[strings.ToLower(ext)] = tmpl
+	}
+
+	if s.flags.Layouts != "" {
+		tmpls, err := s.loadListTemplates(s.flags.Layouts)
+		if err != nil {
+			return fmt.Errorf("load layouts from %q: %w", s.flags.Layouts, err)
+		}
+
+		// Layouts are selected by their file names without the
+		// extension, but the templates keep their full file names so
+		// that their sources can be found again.
+		s.layoutTmpls = make(map[string]*template.Template, len(tmpls))
+		for name, tmpl := range tmpls {
+			s.layoutTmpls[RemoveExt(name)] = tmpl
+		}
+	}
+
+	indexTmpl, err := loadTemplate(s.newTemplate("index"), defaultIndex, s.flags.Index)
+	if err != nil {
+		return fmt.Errorf("load index template: %w", err)
+	}
+	s.indexTmpl = indexTmpl
+
+	if s.flags.Tags {
+		tagTmpl, err := loadTemplate(s.newTemplate("tag"), defaultTag, s.flags.TagTmpl)
+		if err != nil {
+			return fmt.Errorf("load tag template: %w", err)
+		}
+		s.tagTmpl = tagTmpl
+	}
+
+	if s.flags.Sections {
+		s.sectionTmpl = indexTmpl
+		if s.flags.SectTmpl != "" {
+			sectionTmpl, err := loadTemplate(s.newTemplate("section"), defaultIndex, s.flags.SectTmpl)
+			if err != nil {
+				return fmt.Errorf("load section index template: %w", err)
+			}
+			s.sectionTmpl = sectionTmpl
+		}
+	}
+
+	if s.flags.DirIndex {
+		dirTmpl, err := loadTemplate(s.newTemplate("dirindex"), defaultDirIndex, s.flags.DirTmpl)
+		if err != nil {
+			return fmt.Errorf("load directory index template: %w", err)
+		}
+		s.dirTmpl = dirTmpl
+	}
+
+	// Each extra is parsed separately, and named after its full path,
+	// so that extras with the same file name in different directories
+	// don't clobber each other.
+	s.extraTmpls = make(map[string]*template.Template, len(s.flags.Extras))
+	for _, src := range sortedKeys(s.flags.Extras) {
+		tmpl, err := loadTemplate(s.newTemplate(src), "", src)
+		if err != nil {
+			return fmt.Errorf("load extra template %q: %w", src, err)
+		}
+		s.extraTmpls[src] = tmpl
+	}
+
+	if s.flags.PagesDir != "" {
+		listTmpls, err := s.loadListTemplates(s.flags.PagesDir)
+		if err != nil {
+			return fmt.Errorf("load templates from %q: %w", s.flags.PagesDir, err)
+		}
+		s.listTmpls = listTmpls
+	}
+
+	return nil
+}
+
+// loadListTemplates loads each of the HTML files in dir as a separate
+// template, returning them mapped by their file names.
+func (s *Site) loadListTemplates(dir string) (map[string]*template.Template, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpls := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || IsHidden(name) || !strings.EqualFold(filepath.Ext(name), ".html") {
+			continue
+		}
+
+		tmpl, err := loadTemplate(s.newTemplate(name), "", filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("load %q: %w", name, err)
+		}
+		tmpls[name] = tmpl
+	}
+	return tmpls, nil
+}
+
+// pageOptions returns the options used to load each of the site's
+// pages.
+func (s *Site) pageOptions() ([]PageOption, error) {
+	linkFlags, err := parseLinkFlags(s.flags.ExternalLinks)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaults map[string]interface{}
+	if s.flags.PageDefaults != "" {
+		defaults, err = readMetaFile(s.flags.PageDefaults)
+		if err != nil {
+			return nil, fmt.Errorf("read page defaults: %w", err)
+		}
+		if s.flags.ExpandEnv {
+			expandEnv(defaults)
+		}
+	}
+
+	return []PageOption{
+		WithStyle(s.flags.HLStyle),
+		WithContentTemplate(s.flags.ContentTemplate),
+		WithExpandEnv(s.flags.ExpandEnv),
+		WithMetaFormat(s.flags.MetaFormat),
+		WithFuncs(s.funcs),
+		WithSidecarWins(s.flags.SidecarWins),
+		WithDefaults(defaults),
+		WithSourceDir(s.flags.Source),
+		WithOutputs(s.flags.Formats),
+		WithExtensions(s.extensions),
+		WithLinkFlags(linkFlags),
+		WithAnchors(s.flags.Anchors),
+		WithLineNumbers(s.flags.LineNos),
+		WithLineNumbersInTable(s.flags.LineNosTable),
+		WithHighlightClasses(s.flags.HLClasses),
+		WithWordsPerMinute(s.flags.WPM),
+		WithStrict(s.flags.Strict),
+		WithMissingKey(s.flags.MissingKey),
+	}, nil
+}
+
+// sortSite sorts pages by the sort specification given by -sort.
+// Pages are sorted by path first so that pages with equal or missing
+// keys don't depend on the order in which they were loaded.
+func sortSite(pages []*PageInfo, key string, desc bool) {
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Path < pages[j].Path
+	})
+	sortPages(pages, key, desc)
+}
+
+// loadPages concurrently loads the pages at the provided paths,
+// sorting them as specified by -sort. If the build is configured to keep going
+// after errors, the pages that loaded successfully are kept even if
+// an error is returned.
+func (s *Site) loadPages(ctx context.Context, sources []string) error {
+	key, desc, err := parseSort(s.flags.Sort)
+	if err != nil {
+		return fmt.Errorf("sort pages: %w", err)
+	}
+
+	options, err := s.pageOptions()
+	if err != nil {
+		return err
+	}
+
+	// Pages are collected in whatever order they finish loading in
+	// and then sorted once at the end, which is O(n log n) in the
+	// number of pages. Holding the lock is only needed for the append
+	// itself, so contention is negligible compared to the cost of
+	// loading a page.
+	var pages []*PageInfo
+	var mpages sync.Mutex
+
+	// With -keep-going, errors don't cancel the loading of the other
+	// pages.
+	newGroup := multierr.WithContext
+	if s.flags.KeepGoing {
+		newGroup = multierr.WithContextNoCancel
+	}
+	eg, _ := newGroup(ctx)
+	eg.Serial = s.flags.Serial
+	eg.Limit = int(s.flags.Jobs)
+	for _, path := range sources {
+		path := path
+		eg.GoContext(func(ctx context.Context) error {
+			// Pages that haven't started loading by the time that the
+			// build is canceled are skipped.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			page, err := LoadPage(path, s.data, options...)
+			if errors.Is(err, ErrEmptyPage) {
+				warnf("skipping empty source %q", path)
+				return nil
+			}
+			if err != nil {
+				return sourceError("load", path, err)
+			}
+
+			mpages.Lock()
+			pages = append(pages, page)
+			mpages.Unlock()
+			return nil
+		})
+	}
+
+	errs := eg.Wait()
+	if (len(errs) > 0) && !s.flags.KeepGoing {
+		return &StageError{Stage: "loading pages", Errs: errs}
+	}
+
+	sortSite(pages, key, desc)
+	s.pages = pages
+	if len(errs) > 0 {
+		return &StageError{Stage: "loading pages", Errs: errs}
+	}
+	return nil
+}
+
+// pageTemplate returns the template that should be used to output
+// page in the given format.
+func (s *Site) pageTemplate(page *PageInfo, format string) *template.Template {
+	if format == "html" {
+		if layout := page.Layout(); layout != "" {
+			return s.layoutTmpls[layout]
+		}
+		if tmpl, ok := s.extTmpls[strings.ToLower(filepath.Ext(page.Path))]; ok {
+			return tmpl
+		}
+	}
+
+	return s.pageTmpls[format]
+}
+
+// content is a template function that returns the rendered content
+// of the page with the given ID. Because it needs all of the pages to
+// have been loaded, it can't be used in the content of pages
+// themselves.
+func (s *Site) content(id string) (string, error) {
+	if s.byID == nil {
+		return "", errors.New("content is not available until all pages are loaded")
+	}
+
+	page, ok := s.byID[id]
+	if !ok {
+		return "", fmt.Errorf("no page with ID %q", id)
+	}
+	return page.Content, nil
+}
+
+// markdownExtensions returns the blackfriday extensions that the site's
+// markdown should be parsed with: the common extensions and task
+// lists, without autolinking if it was disabled with -autolink,
+// toggled by -md.
+func (s *Site) markdownExtensions() (blackfriday.Extensions, error) {
+	ext := blackfriday.CommonExtensions | markdown.TaskLists
+	if !s.flags.Autolink {
+		ext &^= blackfriday.Autolink
+	}
+
+	ext, err := parseExtensions(ext, s.flags.Markdown)
+	if err != nil {
+		return 0, fmt.Errorf("markdown extensions: %w", err)
+	}
+	return ext, nil
+}
+
+// markdownify is a template function that renders a string of
+// markdown as HTML with the same extensions as the site's pages,
+// including any that were enabled or disabled with -md.
+func (s *Site) markdownify(src string) (string, error) {
+	return markdownifyWith(s.extensions, src)
+}
+
+// hlcss is a template function that returns the slash-separated path,
+// relative to the output directory, of the stylesheet for highlighted
+// code, or an empty string if highlighted code uses inline styles.
+func (s *Site) hlcss() string {
+	if !s.flags.HLClasses {
+		return ""
+	}
+	return filepath.ToSlash(s.flags.HLCSS)
+}
+
+// collect groups the site's pages into collections by their
+// "collection" metadata. Each collection is sorted as configured, or
+// left in the same order as the full list of pages if it isn't.
+func (s *Site) collect() error {
+	s.collections = make(map[string][]*PageInfo)
+	for _, page := range s.listed {
+		name, ok := page.Meta["collection"].(string)
+		if !ok {
+			continue
+		}
+		s.collections[name] = append(s.collections[name], page)
+	}
+
+	for name, spec := range s.flags.Collections {
+		key, desc, err := parseSort(spec)
+		if err != nil {
+			return fmt.Errorf("sort collection %q: %w", name, err)
+		}
+		sortPages(s.collections[name], key, desc)
+	}
+
+	return nil
+}
+
+// checkOutputs returns a *StageError listing every page that would
+// output to the same file as an earlier page, such as two pages whose
+// titles produce the same slug.
+func checkOutputs(pages []*PageInfo) error {
+	owners := make(map[string]*PageInfo)
+	var errs []error
+	for _, page := range pages {
+		for _, format := range page.Outputs() {
+			out := page.OutputFormat(format)
+			if other, ok := owners[out]; ok {
+				errs = append(errs, sourceError("output", page.Path, fmt.Errorf("%q is also output by %q", out, other.Path)))
+				continue
+			}
+			owners[out] = page
+		}
+	}
+
+	if len(errs) > 0 {
+		return &StageError{Stage: "checking outputs", Errs: errs}
+	}
+	return nil
+}
+
+// checkLayouts returns a *StageError listing every page that selects a
+// layout that doesn't exist. Layouts only apply to HTML output, so
+// pages that aren't output as HTML are not checked.
+func (s *Site) checkLayouts() error {
+	var errs []error
+	for _, page := range s.pages {
+		layout := page.Layout()
+		if (layout == "") || !page.hasOutput("html") {
+			continue
+		}
+		if _, ok := s.layoutTmpls[layout]; ok {
+			continue
+		}
+
+		if s.flags.Layouts == "" {
+			errs = append(errs, sourceError("check", page.Path, fmt.Errorf("layout %q selected, but no layouts directory given", layout)))
+			continue
+		}
+		errs = append(errs, sourceError("check", page.Path, fmt.Errorf("no layout %q in %q", layout, s.flags.Layouts)))
+	}
+
+	if len(errs) > 0 {
+		return &StageError{Stage: "checking layouts", Errs: errs}
+	}
+	return nil
+}
+
+// linkPages sets the previous and next pages of each of pages to its
+// neighbors in the slice.
+func linkPages(pages []*PageInfo) {
+	for i, page := range pages {
+		if i > 0 {
+			page.prev = pages[i-1]
+		}
+		if i < len(pages)-1 {
+			page.next = pages[i+1]
+		}
+	}
+}
+
+// publishable returns the pages that should be published, logging
+// the reason for skipping each of the others.
+func (s *Site) publishable(pages []*PageInfo) []*PageInfo {
+	published := pages[:0]
+	for _, page := range pages {
+		if reason := s.unpublished(page); reason != "" {
+			infof("Skipped %q: %v", page.Path, reason)
+			atomic.AddInt64(&s.stats.Skipped, 1)
+			continue
+		}
+		published = append(published, page)
+	}
+	return published
+}
+
+// unpublished returns the reason that page should not be published,
+// or an empty string if it should be.
+func (s *Site) unpublished(page *PageInfo) string {
+	if draft, _ := page.Meta["draft"].(bool); draft && !s.flags.Drafts {
+		return "draft"
+	}
+
+	if t, ok := page.Meta["time"].(time.Time); ok && !s.flags.Future && t.After(s.now) {
+		return "dated in the future"
+	}
+
+	for _, key := range []string{"expires", "expiryDate"} {
+		if t, ok := metaTime(page.Meta[key]); ok && !s.flags.Expired && !t.After(s.now) {
+			return "expired"
+		}
+	}
+
+	return ""
+}
+
+// generate concurrently generates the index, the pages, the extras,
+// and the templates from the pages directory into the output
+// directory, and copies the static files into it.
+func (s *Site) generate(ctx context.Context) error {
+	err := os.MkdirAll(s.flags.Output, 0755)
+	if err != nil {
+		return fmt.Errorf("make output directory: %w", err)
+	}
+
+	static, err := s.findStatic()
+	if err != nil {
+		return fmt.Errorf("find static files: %w", err)
+	}
+
+	seg, _ := multierr.WithContext(ctx)
+	seg.Serial = s.flags.Serial
+	s.copyStatic(seg, static)
+	if errs := seg.Wait(); len(errs) > 0 {
+		return &StageError{Stage: "copying static files", Errs: errs}
+	}
+
+	if s.flags.Incremental {
+		var config string
+		s.previous, config, err = s.readPrevious()
+		if err != nil {
+			return err
+		}
+		s.reconfigured = config != s.configHash()
+	}
+
+	eg, _ := multierr.WithContext(ctx)
+	eg.Serial = s.flags.Serial
+
+	if s.flags.GenIndex {
+		pages, err := s.rootIndexPages()
+		if err != nil {
+			return err
+		}
+
+		index, err := paginate(pages, s.flags.PerPage, s.flags.PagePath)
+		if err != nil {
+			return fmt.Errorf("paginate index: %w", err)
+		}
+
+		for _, ip := range index {
+			ip := ip
+			eg.Go(func() error {
+				path := filepath.Join(s.flags.Output, filepath.FromSlash(ip.Path))
+				err := s.writeFile(output{Path: path, ModTime: s.lastModified(), Sources: nonEmpty(s.flags.Index), Page: true}, func(w io.Writer) error {
+					return genIndex(w, ip, s.collections, s.indexTmpl, s.data)
+				})
+				if err != nil {
+					return fmt.Errorf("generate index: %w", err)
+				}
+
+				infof("Generated %q", path)
+				return nil
+			})
+		}
+	}
+
+	for _, page := range s.pages {
+		for _, format := range page.Outputs() {
+			page, format := page, format
+			eg.GoContext(func(ctx context.Context) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				path := filepath.Join(s.flags.Output, filepath.FromSlash(page.OutputFormat(format)))
+				o := output{Path: path, ModTime: page.InputInfo.ModTime(), Sources: []string{page.Path}, Page: true}
+
+				if s.flags.Incremental {
+					o.Deps = s.pageDeps(page, format)
+					stale, err := s.stale(o, page, format)
+					if err != nil {
+						return err
+					}
+					if stale == "" {
+						infof("Skipped %q: up to date", path)
+						atomic.AddInt64(&s.stats.Skipped, 1)
+						return s.keepFile(o)
+					}
+					debugf("Regenerating %q: %v", path, stale)
+				}
+
+				err := s.writeFile(o, func(w io.Writer) error {
+					return page.Execute(w, s.pageTemplate(page, format), s.data, s.listed)
+				})
+				if err != nil {
+					return fmt.Errorf("execute %q as %v: %w", page.Input(), format, err)
+				}
+
+				infof("Generated %q", path)
+				atomic.AddInt64(&s.stats.Pages, 1)
+				return nil
+			})
+		}
+	}
+
+	eg.Go(func() error {
+		if !s.flags.HLClasses {
+			return nil
+		}
+
+		path := filepath.Join(s.flags.Output, filepath.FromSlash(s.flags.HLCSS))
+		err := s.writeFile(output{Path: path, ModTime: s.lastModified()}, func(w io.Writer) error {
+			return genHighlightCSS(w, s.flags.HLStyle)
+		})
+		if err != nil {
+			return fmt.Errorf("generate highlighting stylesheet: %w", err)
+		}
+
+		infof("Generated %q", path)
+		return nil
+	})
+
+	eg.Go(func() error {
+		if s.flags.RSS == "" {
+			return nil
+		}
+
+		path := filepath.Join(s.flags.Output, filepath.FromSlash(s.flags.RSS))
+		err := s.writeFile(output{Path: path, ModTime: s.lastModified()}, func(w io.Writer) error {
+			return genRSS(w, s.listed, s.data, s.baseURL(), s.lastModified())
+		})
+		if err != nil {
+			return fmt.Errorf("generate RSS feed: %w", err)
+		}
+
+		infof("Generated %q", path)
+		return nil
+	})
+
+	eg.Go(func() error {
+		if s.flags.Atom == "" {
+			return nil
+		}
+
+		if s.baseURL() == "" {
+			warnf("no base URL, so the Atom feed's IDs will not be absolute URLs")
+		}
+
+		path := filepath.Join(s.flags.Output, filepath.FromSlash(s.flags.Atom))
+		err := s.writeFile(output{Path: path, ModTime: s.lastModified()}, func(w io.Writer) error {
+			return genAtom(w, s.listed, s.data, s.baseURL(), s.flags.Atom)
+		})
+		if err != nil {
+			return fmt.Errorf("generate Atom feed: %w", err)
+		}
+
+		infof("Generated %q", path)
+		return nil
+	})
+
+	eg.Go(func() error {
+		if s.flags.Sitemap == "" {
+			return nil
+		}
+
+		path := filepath.Join(s.flags.Output, filepath.FromSlash(s.flags.Sitemap))
+		err := s.writeFile(output{Path: path, ModTime: s.lastModified()}, func(w io.Writer) error {
+			return genSitemap(w, s.listed, s.baseURL(), s.flags.GenIndex)
+		})
+		if err != nil {
+			return fmt.Errorf("generate sitemap: %w", err)
+		}
+
+		infof("Generated %q", path)
+		return nil
+	})
+
+	if s.flags.DirIndex {
+		s.generateDirIndexes(eg)
+	}
+
+	if s.flags.Sections {
+		err := s.generateSectionIndexes(eg)
+		if err != nil {
+			eg.Wait()
+			return err
+		}
+	}
+
+	if s.flags.Tags {
+		s.generateTags(eg)
+	}
+
+	for _, src := range sortedKeys(s.flags.Extras) {
+		src, dst := src, s.flags.Extras[src]
+		eg.Go(func() error {
+			path := filepath.Join(s.flags.Output, dst)
+			err := s.writeFile(output{Path: path, ModTime: s.lastModified(), Sources: []string{src}}, func(w io.Writer) error {
+				return s.extraTmpls[src].Execute(w, map[string]interface{}{
+					"Data":        s.data,
+					"Pages":       s.listed,
+					"Collections": s.collections,
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("execute %q: %w", src, err)
+			}
+
+			infof("Generated %q", path)
+			atomic.AddInt64(&s.stats.Extras, 1)
+			return nil
+		})
+	}
+
+	listNames := make([]string, 0, len(s.listTmpls))
+	for name := range s.listTmpls {
+		listNames = append(listNames, name)
+	}
+	sort.Strings(listNames)
+
+	for _, name := range listNames {
+		name, tmpl := name, s.listTmpls[name]
+		eg.Go(func() error {
+			path := filepath.Join(s.flags.Output, name)
+			err := s.writeFile(output{Path: path, ModTime: s.lastModified(), Sources: []string{filepath.Join(s.flags.PagesDir, name)}, Page: true}, func(w io.Writer) error {
+				return tmpl.Execute(w, map[string]interface{}{
+					"Data":        s.data,
+					"Pages":       s.listed,
+					"Collections": s.collections,
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("execute %q: %w", name, err)
+			}
+
+			infof("Generated %q", path)
+			atomic.AddInt64(&s.stats.Extras, 1)
+			return nil
+		})
+	}
+
+	errs := eg.Wait()
+	if len(errs) > 0 {
+		return &StageError{Stage: "generating output", Errs: errs}
+	}
+
+	if s.flags.Headers != "" {
+		err := s.writeHeaders()
+		if err != nil {
+			return fmt.Errorf("write headers: %w", err)
+		}
+	}
+
+	if s.flags.Clean {
+		err := s.clean()
+		if err != nil {
+			return fmt.Errorf("clean: %w", err)
+		}
+	}
+
+	if s.flags.Manifest != "" {
+		err := s.writeManifest()
+		if err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+	}
+
+	// Links are checked after cleaning so that leftovers from previous
+	// builds can't hide broken ones.
+	if s.flags.CheckLinks {
+		errs := s.checkLinks()
+		if (len(errs) > 0) && s.flags.Strict {
+			return &StageError{Stage: "checking links", Errs: errs}
+		}
+		for _, err := range errs {
+			warnf("%v", err)
+		}
+	}
+
+	return nil
+}
+
+// manifestPath returns the path of the site's manifest. Relative
+// paths are relative to the output directory.
+func (s *Site) manifestPath() string {
+	if filepath.IsAbs(s.flags.Manifest) {
+		return s.flags.Manifest
+	}
+	return filepath.Join(s.flags.Output, filepath.FromSlash(s.flags.Manifest))
+}
+
+// writeManifest writes a manifest of all of the site's outputs.
+func (s *Site) writeManifest() error {
+	m := manifest.Manifest{
+		Built:  time.Now(),
+		Config: s.configHash(),
+		Files:  make([]manifest.File, 0, len(s.outputs)),
+	}
+	for _, o := range s.outputs {
+		rel, err := filepath.Rel(s.flags.Output, o.Path)
+		if err != nil {
+			return err
+		}
+
+		m.Files = append(m.Files, manifest.File{
+			Path:    filepath.ToSlash(rel),
+			Sources: o.Sources,
+			Hash:    o.Hash,
+			ModTime: o.ModTime,
+			Deps:    o.Deps,
+		})
+	}
+
+	return m.Write(s.manifestPath())
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeFile calls render to produce the contents of the file at
+// o.Path and then writes them through the site's processor chain,
+// recording the file as one of the site's outputs.
+func (s *Site) writeFile(o output, render func(w io.Writer) error) error {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
+	err := render(buf)
+	if err != nil {
+		return err
+	}
+
+	content, err := writeOutput(o.Path, buf.Bytes(), s.processors)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(content)
+	o.Hash = hex.EncodeToString(hash[:])
+	s.addOutput(o)
+
+	return nil
+}
+
+// addOutput records that o is part of the output of the build.
+func (s *Site) addOutput(o output) {
+	s.moutputs.Lock()
+	defer s.moutputs.Unlock()
+	s.outputs = append(s.outputs, o)
+}
+
+// nonEmpty returns a slice containing the non-empty strings out of
+// those provided.
+func nonEmpty(strs ...string) []string {
+	var r []string
+	for _, str := range strs {
+		if str != "" {
+			r = append(r, str)
+		}
+	}
+	return r
+}
+
+// baseURL returns the URL of the root of the site, which is given by
+// -baseurl or, failing that, the "link" key in the data file.
+func (s *Site) baseURL() string {
+	if s.flags.BaseURL != "" {
+		return s.flags.BaseURL
+	}
+	return dataString(s.data, "link")
+}
+
+// lastModified returns the latest modification time of any of the
+// site's page sources. This is used as the modification time of
+// outputs that depend on all of the pages, such as the index.
+func (s *Site) lastModified() (t time.Time) {
+	for _, page := range s.pages {
+		if mt := page.InputInfo.ModTime(); mt.After(t) {
+			t = mt
+		}
+	}
+	return t
+}
+
+// writeHeaders writes the suggested HTTP headers for all of the
+// site's outputs to the configured headers file.
+func (s *Site) writeHeaders() error {
+	data, err := marshalHeaders(s.flags.Output, s.outputs, headerPolicy{
+		PageCache:  s.flags.PageCache,
+		AssetCache: s.flags.AssetCache,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.flags.Output, s.flags.Headers)
+	_, err = writeOutput(path, data, nil)
+	if err != nil {
+		return err
+	}
+
+	infof("Generated %q", path)
+	return nil
+}
+
+// generateTags starts generating a page for every tag used by the
+// listed pages.
+func (s *Site) generateTags(eg *multierr.MultiErr) {
+	tags := collectTags(s.listed)
+	slugs := make([]string, 0, len(tags))
+	for slug := range tags {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	for _, slug := range slugs {
+		tp := tags[slug]
+		eg.Go(func() error {
+			path := filepath.Join(s.flags.Output, filepath.FromSlash(tp.Path))
+			err := s.writeFile(output{Path: path, ModTime: s.lastModified(), Sources: nonEmpty(s.flags.TagTmpl), Page: true}, func(w io.Writer) error {
+				return s.tagTmpl.Execute(w, map[string]interface{}{
+					"Data":  s.data,
+					"Tag":   tp.Tag,
+					"Pages": tp.Pages,
+					"Root":  rootLink(tp.Path),
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("generate page for tag %q: %w", tp.Tag, err)
+			}
+
+			infof("Generated %q", path)
+			return nil
+		})
+	}
+}
+
+// generateDirIndexes starts generating an index.html in every output
+// subdirectory that contains pages, skipping any directories in which
+// a page already outputs to index.html.
+func (s *Site) generateDirIndexes(eg *multierr.MultiErr) {
+	taken := make(map[string]struct{})
+	for _, page := range s.pages {
+		for _, format := range page.Outputs() {
+			taken[page.OutputFormat(format)] = struct{}{}
+		}
+	}
+
+	indexes := dirIndexes(s.listed)
+	dirs := make([]string, 0, len(indexes))
+	for dir := range indexes {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		index := indexes[dir]
+		if _, ok := taken[path.Join(dir, "index.html")]; ok {
+			continue
+		}
+
+		eg.Go(func() error {
+			path := filepath.Join(s.flags.Output, filepath.FromSlash(index.Dir), "index.html")
+			err := s.writeFile(output{Path: path, ModTime: s.lastModified(), Sources: nonEmpty(s.flags.DirTmpl), Page: true}, func(w io.Writer) error {
+				return s.dirTmpl.Execute(w, map[string]interface{}{
+					"Data":  s.data,
+					"Dir":   index.Dir,
+					"Pages": index.Pages,
+					"Dirs":  index.Dirs,
+				})
+			})
+			if err != nil {
+				return fmt.Errorf("generate index of %q: %w", index.Dir, err)
+			}
+
+			infof("Generated %q", path)
+			return nil
+		})
+	}
+}
+
+// genIndex generates a page of the index from the given pages and
+// collections using the provided template and writes it to w. The
+// template is also given a link back to the root of the output
+// directory as .Root, so that links to pages work from index pages in
+// subdirectories, and, if the index is paginated, the page's
+// .Pagination.
+func genIndex(w io.Writer, ip indexPage, collections map[string][]*PageInfo, tmpl *template.Template, data interface{}) error {
+	err := tmpl.Execute(w, map[string]interface{}{
+		"Pages":       ip.Pages,
+		"Collections": collections,
+		"Data":        data,
+		"Root":        rootLink(ip.Path),
+		"Pagination":  ip.Pagination,
+		"Section":     ip.Section,
+	})
+	if err != nil {
+		return fmt.Errorf("template execute: %w", err)
+	}
+	return nil
+}
+
+// StageError is returned by Site.Build when one or more errors occur
+// during a concurrent stage of the build.
+type StageError struct {
+	// Stage describes the stage of the build during which the errors
+	// occurred, such as "loading pages".
+	Stage string
+
+	// Errs are the errors that occurred.
+	Errs []error
+}
+
+func (err *StageError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "error(s) while %v:", err.Stage)
+	for _, e := range err.Errs {
+		fmt.Fprintf(&sb, " %v;", e)
+	}
+	return strings.TrimSuffix(sb.String(), ";")
+}
+
+// Unwrap returns the errors that occurred combined into one, so that
+// errors.Is and errors.As match a StageError if they match any of
+// them, such as to find out if the build was interrupted.
+func (err *StageError) Unwrap() error {
+	return multierr.Combine(err.Errs)
+}
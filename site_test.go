@@ -0,0 +1,1275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeedleFake/bog/internal/cli"
+	"github.com/gosimple/slug"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// testTime is the modification time given to the sources of test
+// sites so that the output doesn't depend on when they were checked
+// out.
+var testTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// buildSite builds the site in src into out with the given
+// command-line arguments, quietly.
+func buildSite(src, out string, args ...string) error {
+	defer func(lvl logLevel) { logLvl = lvl }(logLvl)
+	logLvl = levelQuiet
+
+	flags, err := parseFlags(append([]string{"-out", out, "-manifest", ""}, append(args, src)...)...)
+	if err != nil {
+		return err
+	}
+
+	return NewSite(flags).Build(context.Background())
+}
+
+// parseFlags parses command-line arguments into flags.
+func parseFlags(args ...string) (flags, error) {
+	flags := newFlags()
+	fs := flag.NewFlagSet("bog", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	err := cli.ParseFlagSet(fs, args, &flags, nil)
+	return flags, err
+}
+
+// copySources copies the regular files directly in dir into a new
+// temporary directory, which it returns, with their modification times
+// set to testTime.
+func copySources(t *testing.T, dir string) string {
+	t.Helper()
+
+	tmp := t.TempDir()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		dst := filepath.Join(tmp, file.Name())
+		_, err := copyFile(dst, filepath.Join(dir, file.Name()), file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(dst, testTime, testTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmp
+}
+
+// readTree returns the contents of the files under dir, keyed by their
+// slash-separated paths relative to it.
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestBuildGolden(t *testing.T) {
+	src := copySources(t, "testdata")
+	out := filepath.Join(t.TempDir(), "out")
+
+	err := buildSite(src, out,
+		"-data", filepath.Join(src, "data.yaml"),
+		"-extras", filepath.Join(src, "extra.tmpl")+":extra.txt",
+		"-format", "html,text",
+	)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "golden")
+	got := readTree(t, out)
+	if *update {
+		err := os.RemoveAll(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range got {
+			p := filepath.Join(golden, filepath.FromSlash(name))
+			err := os.MkdirAll(filepath.Dir(p), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(p, data, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+
+	want := readTree(t, golden)
+	names := make([]string, 0, len(got)+len(want))
+	for name := range got {
+		names = append(names, name)
+	}
+	for name := range want {
+		if _, ok := got[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g, gok := got[name]
+		w, wok := want[name]
+		switch {
+		case !wok:
+			t.Errorf("unexpected output %q", name)
+		case !gok:
+			t.Errorf("missing output %q", name)
+		case !bytes.Equal(g, w):
+			t.Errorf("%q differs from the golden file:\ngot:\n%s\nwant:\n%s", name, g, w)
+		}
+	}
+}
+
+// TestBuildBust checks that bust works in content templates, which are
+// executed before static files are copied, even when the build is
+// serial.
+func TestBuildBust(t *testing.T) {
+	src := t.TempDir()
+	err := os.Mkdir(filepath.Join(src, "static"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "static", "style.css"), []byte("body {}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "page.md"), []byte("<!--meta\ncss: /style.css\n-->\nStyle: {{bust .Page.Meta.css}}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hashFile(filepath.Join(src, "static", "style.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out, "-serial")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(out, "page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/style.css?v=" + hash; !bytes.Contains(content, []byte(want)) {
+		t.Errorf("page doesn't link to %q:\n%s", want, content)
+	}
+}
+
+func TestBuildStaticIgnore(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"page.md":                   "# Page\n",
+		"static/.bogignore":         "*.psd\ndrafts/\n",
+		"static/style.css":          "body {}\n",
+		"static/logo.psd":           "layers\n",
+		"static/drafts/new.css":     "p {}\n",
+		"static/img/.bogignore":     "!*.psd\n",
+		"static/img/logo.psd":       "layers\n",
+		"static/img/drafts/old.png": "png\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, out)
+	for _, name := range []string{"style.css", "img/logo.psd"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("%q wasn't copied", name)
+		}
+	}
+	for _, name := range []string{"logo.psd", "drafts/new.css", "img/drafts/old.png", ".bogignore"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%q was copied", name)
+		}
+	}
+}
+
+// TestBuildManyPages builds a site with many pages that use template
+// functions and features that share state between goroutines. It is
+// mostly useful with -race.
+func TestBuildManyPages(t *testing.T) {
+	src := t.TempDir()
+	const n = 300
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf(`<!--meta
+title: "Page %[1]v"
+time: 2020-01-01T00:%02[2]v:%02[3]vZ
+css: /style.css
+tags: [t%[4]v, all]
+collection: c%[4]v
+-->
+{{toc .Page}}
+
+# {{.Page.Meta.title | slugify}}
+
+Page %[1]v with {{bust .Page.Meta.css}}
+
+## Section
+
+Some more text, and a [link](page-%[5]v.html#section).
+`, i, i/60, i%60, i%7, (i+1)%n)
+
+		err := ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("p%v.md", i)), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := os.MkdirAll(filepath.Join(src, "static"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "static", "style.css"), []byte("body {}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out,
+		"-jobs", "0",
+		"-tags",
+		"-rss", "feed.xml",
+		"-atom", "atom.xml",
+		"-sitemap", "sitemap.xml",
+		"-baseurl", "https://example.com/",
+		"-anchors",
+		"-checklinks",
+		"-strict",
+	)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	files := readTree(t, out)
+	for i := 0; i < n; i++ {
+		if _, ok := files[fmt.Sprintf("page-%v.html", i)]; !ok {
+			t.Errorf("missing output for page %v", i)
+		}
+	}
+}
+
+// BenchmarkLoadPages loads a site of many small pages. Compared with
+// BenchmarkSortSite, it shows how much of the cost of loading a large
+// site is sorting rather than loading and collecting the pages.
+func BenchmarkLoadPages(b *testing.B) {
+	defer func(lvl logLevel) { logLvl = lvl }(logLvl)
+	logLvl = levelQuiet
+
+	const n = 10000
+	src := b.TempDir()
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("<!--meta\ntime: 2020-01-01T%02v:%02v:00Z\n-->\n# Page %v\n\nText.\n", (i/60)%24, i%60, i)
+		err := ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("p%v.md", i)), []byte(content), 0644)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	flags, err := parseFlags(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := NewSite(flags)
+	sources, err := s.findSources()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := s.loadPages(context.Background(), sources)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(s.pages) != n {
+			b.Fatalf("loaded %v pages, not %v", len(s.pages), n)
+		}
+	}
+}
+
+// TestBuildIncrementalNeighbors checks that incremental builds
+// regenerate pages whose neighbors change even if the pages
+// themselves haven't.
+func TestBuildIncrementalNeighbors(t *testing.T) {
+	src := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(src, name)
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(p, testTime, testTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("page.tmpl", "{{.Page.Meta.title}} after {{with .Prev}}{{.Meta.title}}{{else}}nothing{{end}}\n")
+	write("a.md", "<!--meta\ntitle: A\ntime: 2020-01-01\n-->\nA\n")
+	write("c.md", "<!--meta\ntitle: C\ntime: 2020-01-03\n-->\nC\n")
+
+	out := filepath.Join(t.TempDir(), "out")
+	build := func() {
+		err := buildSite(src, out,
+			"-incremental",
+			"-manifest", ".bog/manifest.json",
+			"-page", filepath.Join(src, "page.tmpl"),
+			"-sort", "time:asc",
+		)
+		if err != nil {
+			t.Fatalf("build: %v", err)
+		}
+	}
+	check := func(name, want string) {
+		t.Helper()
+		content, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(content); got != want {
+			t.Errorf("%v: got %q, want %q", name, got, want)
+		}
+	}
+
+	build()
+	check("c.html", "C after A\n")
+
+	write("b.md", "<!--meta\ntitle: B\ntime: 2020-01-02\n-->\nB\n")
+	build()
+	check("a.html", "A after nothing\n")
+	check("b.html", "B after A\n")
+	check("c.html", "C after B\n")
+}
+
+// TestBuildRefLink checks that ref works in the destinations of
+// markdown links, which markdown rendering escapes the quotes in.
+func TestBuildRefLink(t *testing.T) {
+	src := t.TempDir()
+	pages := map[string]string{
+		"one.md":       "# One\n\nSee [the other]({{ref \"sub/other.md\"}}) and {{ref \"sub/other.md\"}}.\n",
+		"sub/other.md": "# Other\n\nBack to [one]({{ref \"one.md\"}}).\n",
+	}
+	for name, content := range pages {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out, "-checklinks", "-strict")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	files := readTree(t, out)
+	for name, want := range map[string]string{
+		"one.html":       `See <a href="sub/other.html">the other</a> and sub/other.html.`,
+		"sub/other.html": `Back to <a href="../one.html">one</a>.`,
+	} {
+		if !bytes.Contains(files[name], []byte(want)) {
+			t.Errorf("%v doesn't contain %q:\n%s", name, want, files[name])
+		}
+	}
+}
+
+func TestBuildOutputs(t *testing.T) {
+	src := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(src, "page.md"), []byte("<!--meta\ntitle: Both\noutputs: [html, text]\n-->\nSome *text*.\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "other.md"), []byte("<!--meta\ntitle: Other\n-->\nOther.\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	files := readTree(t, out)
+	for name, want := range map[string]string{
+		"both.html": "<p>Some <em>text</em>.</p>",
+		"both.txt":  "Both\n\nSome text.",
+	} {
+		if !bytes.Contains(files[name], []byte(want)) {
+			t.Errorf("%v doesn't contain %q:\n%s", name, want, files[name])
+		}
+	}
+	if _, ok := files["other.txt"]; ok {
+		t.Errorf("other.txt was generated for a page without text output")
+	}
+}
+
+func TestFindSourcesHidden(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"page.md":            "# Page\n",
+		".draft.md":          "# Draft\n",
+		".git/x.md":          "# Git\n",
+		"sub/.obsidian/y.md": "# Obsidian\n",
+		"sub/other.md":       "# Other\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			want: []string{"page.md", "sub/other.md"},
+		},
+		{
+			args: []string{"-include-hidden"},
+			want: []string{".draft.md", ".git/x.md", "page.md", "sub/.obsidian/y.md", "sub/other.md"},
+		},
+	}
+	for _, test := range tests {
+		flags, err := parseFlags(append(test.args, src)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources, err := NewSite(flags).findSources()
+		if err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+
+		got := make([]string, 0, len(sources))
+		for _, p := range sources {
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%v: got %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestBuildOutDir(t *testing.T) {
+	src := t.TempDir()
+	pages := map[string]string{
+		"post.md":     "<!--meta\ntitle: Post\noutdir: blog\n-->\nSee [about]({{ref \"about.md\"}}).\n",
+		"about.md":    "<!--meta\ntitle: About\n-->\nSee [the post]({{ref \"post.md\"}}).\n",
+		"sub/far.md":  "<!--meta\ntitle: Far\noutdir: blog/2020\n-->\nFar.\n",
+		"sub/near.md": "<!--meta\ntitle: Near\n-->\nNear.\n",
+	}
+	for name, content := range pages {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out, "-checklinks")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	files := readTree(t, out)
+	for name, want := range map[string]string{
+		"blog/post.html":     `See <a href="../about.html">about</a>.`,
+		"about.html":         `See <a href="blog/post.html">the post</a>.`,
+		"blog/2020/far.html": "Far.",
+		"sub/near.html":      "Near.",
+	} {
+		if !bytes.Contains(files[name], []byte(want)) {
+			t.Errorf("%v doesn't contain %q:\n%s", name, want, files[name])
+		}
+	}
+}
+
+func TestBuildEmptySource(t *testing.T) {
+	src := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(src, "empty.md"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "page.md"), []byte("# Page\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	files := readTree(t, out)
+	if _, ok := files["page.html"]; !ok {
+		t.Error("page.html wasn't generated")
+	}
+	if _, ok := files["empty.html"]; ok {
+		t.Error("empty.html was generated")
+	}
+}
+
+func TestBuildUnreadableSource(t *testing.T) {
+	src := t.TempDir()
+	locked := filepath.Join(src, "locked.md")
+	err := ioutil.WriteFile(locked, []byte("# Locked\n"), 0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(locked); err == nil {
+		t.Skip("permissions aren't enforced for this user")
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "page.md"), []byte("# Page\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out)
+	if (err == nil) || !strings.Contains(err.Error(), "locked.md") {
+		t.Fatalf("expected an error naming locked.md, got %v", err)
+	}
+
+	err = buildSite(src, out, "-keep-going")
+	if (err == nil) || !strings.Contains(err.Error(), "locked.md") {
+		t.Fatalf("expected an error naming locked.md with -keep-going, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "page.html")); err != nil {
+		t.Errorf("page.html wasn't generated with -keep-going: %v", err)
+	}
+}
+
+func TestBuildSlugMaxLen(t *testing.T) {
+	defer func(n int) { slug.MaxLength = n }(slug.MaxLength)
+	slug.MaxLength = 20
+
+	src := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(src, "long.md"), []byte("<!--meta\ntitle: A Very Long Title That Goes On And On\n-->\n{{slugify .Page.Meta.title}}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	const want = "a-very-long-title"
+	content, err := ioutil.ReadFile(filepath.Join(out, want+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("<p>"+want+"</p>")) {
+		t.Errorf("slugify doesn't agree with the output path:\n%s", content)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(src, "other.md"), []byte("<!--meta\ntitle: A Very Long Title That Differs Later\n-->\nOther.\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buildSite(src, out)
+	if (err == nil) || !strings.Contains(err.Error(), "long.md") || !strings.Contains(err.Error(), "other.md") {
+		t.Errorf("expected a collision naming both pages, got %v", err)
+	}
+}
+
+func TestBuildPagesDir(t *testing.T) {
+	src, pagesDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(src, "a.md"):              "<!--meta\ntitle: A\ntime: 2020-01-01\n-->\nA.\n",
+		filepath.Join(src, "b.md"):              "<!--meta\ntitle: B\ntime: 2020-01-02\n-->\nB.\n",
+		filepath.Join(pagesDir, "archive.html"): "{{range .Pages}}[{{.Meta.title}}]{{end}} {{.Data.name}}\n",
+		filepath.Join(pagesDir, "about.html"):   "{{len .Pages}} pages\n",
+		filepath.Join(pagesDir, "notes.txt"):    "not a template\n",
+		filepath.Join(pagesDir, ".hidden.html"): "hidden\n",
+	}
+	for p, content := range files {
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out, "-pages", pagesDir, "-set", "name=Blog")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, out)
+	for name, want := range map[string]string{
+		"archive.html": "[B][A] Blog\n",
+		"about.html":   "2 pages\n",
+	} {
+		if string(got[name]) != want {
+			t.Errorf("%v: got %q, want %q", name, got[name], want)
+		}
+	}
+	for _, name := range []string{"notes.txt", ".hidden.html"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%v was generated", name)
+		}
+	}
+}
+
+func TestBuildExtPages(t *testing.T) {
+	src, tmpls := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(src, "post.md"):         "<!--meta\ntitle: Post\n-->\nA *post*.\n",
+		filepath.Join(src, "raw.html"):        "<!--meta\ntitle: Raw\n-->\n<p>Raw HTML.</p>\n",
+		filepath.Join(src, "other.markdown"):  "<!--meta\ntitle: Other\n-->\nOther.\n",
+		filepath.Join(tmpls, "post.tmpl"):     "post: {{.Page.Content}}",
+		filepath.Join(tmpls, "raw.tmpl"):      "raw: {{.Page.Content}}",
+		filepath.Join(tmpls, "fallback.tmpl"): "fallback: {{.Page.Content}}",
+	}
+	for p, content := range files {
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out,
+		"-exts", ".md,.markdown,.html",
+		"-page", filepath.Join(tmpls, "fallback.tmpl"),
+		"-ext-pages", ".md:"+filepath.Join(tmpls, "post.tmpl")+",.html:"+filepath.Join(tmpls, "raw.tmpl"),
+	)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, out)
+	for name, want := range map[string]string{
+		"post.html":  "post: <p>A <em>post</em>.</p>",
+		"raw.html":   "raw: <p>Raw HTML.</p>",
+		"other.html": "fallback: <p>Other.</p>",
+	} {
+		if !bytes.HasPrefix(got[name], []byte(want)) {
+			t.Errorf("%v doesn't start with %q:\n%s", name, want, got[name])
+		}
+	}
+}
+
+func TestBuildFuture(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	err := os.Setenv("SOURCE_DATE_EPOCH", fmt.Sprint(testTime.Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	pages := map[string]string{
+		"past.md":   "<!--meta\ntitle: Past\ntime: 2020-05-01T00:00:00Z\n-->\nPast.\n",
+		"future.md": "<!--meta\ntitle: Future\ntime: 2020-07-01T00:00:00Z\n-->\nFuture.\n",
+	}
+	for name, content := range pages {
+		err := ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args      []string
+		published bool
+	}{
+		{args: nil, published: false},
+		{args: []string{"-future"}, published: true},
+	}
+	for _, test := range tests {
+		out := filepath.Join(t.TempDir(), "out")
+		err := buildSite(src, out, append(test.args, "-rss", "feed.xml", "-baseurl", "https://example.com/")...)
+		if err != nil {
+			t.Fatalf("%v: build: %v", test.args, err)
+		}
+
+		files := readTree(t, out)
+		if _, ok := files["past.html"]; !ok {
+			t.Errorf("%v: past.html wasn't generated", test.args)
+		}
+		if _, ok := files["future.html"]; ok != test.published {
+			t.Errorf("%v: future.html generated: %v", test.args, ok)
+		}
+		for _, name := range []string{"index.html", "feed.xml"} {
+			if listed := bytes.Contains(files[name], []byte("future.html")); listed != test.published {
+				t.Errorf("%v: future.html listed in %v: %v", test.args, name, listed)
+			}
+		}
+	}
+}
+
+func TestBuildExpired(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	err := os.Setenv("SOURCE_DATE_EPOCH", fmt.Sprint(testTime.Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	pages := map[string]string{
+		"current.md": "<!--meta\ntitle: Current\ntime: 2020-01-01T00:00:00Z\nexpires: 2020-07-01T00:00:00Z\n-->\nCurrent.\n",
+		"expired.md": "<!--meta\ntitle: Expired\ntime: 2020-01-01T00:00:00Z\nexpires: 2020-05-01T00:00:00Z\n-->\nExpired.\n",
+		"old.md":     "<!--meta\ntitle: Old\ntime: 2020-01-01T00:00:00Z\nexpiryDate: 2020-05-01\n-->\nOld.\n",
+	}
+	for name, content := range pages {
+		err := ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		args      []string
+		published bool
+	}{
+		{args: nil, published: false},
+		{args: []string{"-expired"}, published: true},
+	}
+	for _, test := range tests {
+		out := filepath.Join(t.TempDir(), "out")
+		err := buildSite(src, out, test.args...)
+		if err != nil {
+			t.Fatalf("%v: build: %v", test.args, err)
+		}
+
+		files := readTree(t, out)
+		if _, ok := files["current.html"]; !ok {
+			t.Errorf("%v: current.html wasn't generated", test.args)
+		}
+		for _, name := range []string{"expired.html", "old.html"} {
+			if _, ok := files[name]; ok != test.published {
+				t.Errorf("%v: %v generated: %v", test.args, name, ok)
+			}
+			if listed := bytes.Contains(files["index.html"], []byte(name)); listed != test.published {
+				t.Errorf("%v: %v listed in the index: %v", test.args, name, listed)
+			}
+		}
+	}
+}
+
+func TestBuildCollections(t *testing.T) {
+	src, pagesDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(src, "b1.md"): "<!--meta\ntitle: B1\ncollection: blog\ntime: 2020-01-01\nweight: 1\n-->\nB1.\n",
+		filepath.Join(src, "b2.md"): "<!--meta\ntitle: B2\ncollection: blog\ntime: 2020-01-03\nweight: 3\n-->\nB2.\n",
+		filepath.Join(src, "b3.md"): "<!--meta\ntitle: B3\ncollection: blog\ntime: 2020-01-02\nweight: 2\n-->\nB3.\n",
+		filepath.Join(src, "d1.md"): "<!--meta\ntitle: D1\ncollection: docs\ntime: 2020-01-03\nweight: 2\n-->\nD1.\n",
+		filepath.Join(src, "d2.md"): "<!--meta\ntitle: D2\ncollection: docs\ntime: 2020-01-01\nweight: 3\n-->\nD2.\n",
+		filepath.Join(src, "d3.md"): "<!--meta\ntitle: D3\ncollection: docs\ntime: 2020-01-02\nweight: 1\n-->\nD3.\n",
+		filepath.Join(pagesDir, "lists.html"): `{{range .Collections.blog}}{{.Meta.title}} {{end}}
+{{range .Collections.docs}}{{.Meta.title}} {{end}}
+{{range .Pages}}{{.Meta.title}} {{end}}
+`,
+	}
+	for p, content := range files {
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out,
+		"-pages", pagesDir,
+		"-sort", "title",
+		"-collections", "blog:time,docs:weight",
+	)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(out, "lists.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "B2 B3 B1 \nD3 D1 D2 \nB1 B2 B3 D1 D2 D3 \n"
+	if got := string(content); got != want {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestBuildContentFunc(t *testing.T) {
+	src, pagesDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(src, "post.md"):          "<!--meta\ntitle: Post\n-->\nThe *post*.\n",
+		filepath.Join(pagesDir, "home.html"):   `Home: {{content "post"}}`,
+		filepath.Join(pagesDir, "broken.html"): `{{content "missing"}}`,
+	}
+	for p, content := range files {
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out, "-pages", pagesDir)
+	if (err == nil) || !strings.Contains(err.Error(), `no page with ID "missing"`) {
+		t.Fatalf("expected an error about the missing page, got %v", err)
+	}
+
+	err = os.Remove(filepath.Join(pagesDir, "broken.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buildSite(src, out, "-pages", pagesDir)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(out, "home.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Home: <p>The <em>post</em>.</p>"; !strings.HasPrefix(string(content), want) {
+		t.Errorf("home.html doesn't start with %q:\n%s", want, content)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(src, "embed.md"), []byte("{{content \"post\"}}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buildSite(src, out, "-pages", pagesDir)
+	if (err == nil) || !strings.Contains(err.Error(), "content is not available") {
+		t.Errorf("expected an error using content in page content, got %v", err)
+	}
+}
+
+func TestBuildPageDefaults(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(src, "default.md"):    "<!--meta\ntitle: Default\n-->\n{{.Page.Meta.author}} {{.Page.Meta.license}}\n",
+		filepath.Join(src, "override.md"):   "<!--meta\ntitle: Override\nauthor: Guest\n-->\n{{.Page.Meta.author}} {{.Page.Meta.license}}\n",
+		filepath.Join(dir, "defaults.yaml"): "author: Someone\nlicense: CC0\n",
+	}
+	for p, content := range files {
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out, "-page-defaults", filepath.Join(dir, "defaults.yaml"))
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, out)
+	for name, want := range map[string]string{
+		"default.html":  "<p>Someone CC0</p>",
+		"override.html": "<p>Guest CC0</p>",
+	} {
+		if !bytes.Contains(got[name], []byte(want)) {
+			t.Errorf("%v doesn't contain %q:\n%s", name, want, got[name])
+		}
+	}
+}
+
+// TestBuildConfigOnly builds a site configured entirely by its config
+// file, as running bog with no arguments in the source directory
+// would.
+func TestBuildConfigOnly(t *testing.T) {
+	defer func(lvl logLevel) { logLvl = lvl }(logLvl)
+	logLvl = levelQuiet
+
+	src := t.TempDir()
+	files := map[string]string{
+		"bog.yaml": `out: public
+manifest: ""
+page: templates/page.tmpl
+index: templates/index.tmpl
+data: [data.yaml]
+extras:
+  templates/extra.tmpl: extra.txt
+`,
+		"data.yaml":            "title: Configured\n",
+		"post.md":              "<!--meta\ntitle: Post\n-->\nText.\n",
+		"templates/page.tmpl":  "page {{.Data.title}}: {{.Page.Meta.title}}",
+		"templates/index.tmpl": "index {{.Data.title}}:{{range .Pages}} {{.Meta.title}}{{end}}",
+		"templates/extra.tmpl": "extra {{len .Pages}}",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Chdir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := newFlags()
+	fs := flag.NewFlagSet("bog", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	err = cli.ParseFlagSet(fs, nil, &flags, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applyConfig(fs, flags.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkFlags(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewSite(flags).Build(context.Background())
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, filepath.Join(src, "public"))
+	for name, want := range map[string]string{
+		"post.html":  "page Configured: Post",
+		"index.html": "index Configured: Post",
+		"extra.txt":  "extra 1",
+	} {
+		if string(got[name]) != want {
+			t.Errorf("%v: got %q, want %q", name, got[name], want)
+		}
+	}
+}
+
+func TestBuildContentTemplateError(t *testing.T) {
+	src := t.TempDir()
+	content := `<!--meta
+title: Broken
+-->
+# Broken
+
+Fine {{.Page.Meta.title}}.
+
+Still fine.
+
+Broken {{.Page.Meta.title
+`
+	err := ioutil.WriteFile(filepath.Join(src, "broken.md"), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out)
+	var serr *SourceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected a *SourceError, got %v", err)
+	}
+	if filepath.Base(serr.Path) != "broken.md" {
+		t.Errorf("error names %q, not broken.md", serr.Path)
+	}
+	if serr.Line != 10 {
+		t.Errorf("error is at line %v, not 10: %v", serr.Line, serr)
+	}
+}
+
+func TestBuildDirIndex(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"top.md":              "<!--meta\ntitle: Top\n-->\nTop.\n",
+		"docs/intro.md":       "<!--meta\ntitle: Intro\n-->\nIntro.\n",
+		"docs/guide/setup.md": "<!--meta\ntitle: Setup\n-->\nSetup.\n",
+		"docs/guide/usage.md": "<!--meta\ntitle: Usage\n-->\nUsage.\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpl := filepath.Join(dir, "dir.tmpl")
+	err := ioutil.WriteFile(tmpl, []byte("{{.Dir}}: pages{{range .Pages}} {{.Meta.title}}{{end}}; dirs{{range .Dirs}} {{.}}{{end}}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err = buildSite(src, out, "-dir-index", "-dir-index-template", tmpl, "-sort", "title")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, out)
+	for name, want := range map[string]string{
+		"docs/index.html":       "docs: pages Intro; dirs guide",
+		"docs/guide/index.html": "docs/guide: pages Setup Usage; dirs",
+	} {
+		if string(got[name]) != want {
+			t.Errorf("%v: got %q, want %q", name, got[name], want)
+		}
+	}
+	if !bytes.Contains(got["index.html"], []byte("top.html")) {
+		t.Errorf("the root index isn't the regular index:\n%s", got["index.html"])
+	}
+}
+
+func TestBuildUnlisted(t *testing.T) {
+	src := t.TempDir()
+	pages := map[string]string{
+		"post.md":    "<!--meta\ntitle: Post\n-->\nPost.\n",
+		"about.md":   "<!--meta\ntitle: About\nindex: false\n-->\nAbout.\n",
+		"contact.md": "<!--meta\ntitle: Contact\nlist: false\n-->\nContact.\n",
+	}
+	for name, content := range pages {
+		err := ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out,
+		"-rss", "feed.xml",
+		"-sitemap", "sitemap.xml",
+		"-baseurl", "https://example.com/",
+	)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	got := readTree(t, out)
+	for _, name := range []string{"about.html", "contact.html"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("%v wasn't generated", name)
+		}
+		for _, list := range []string{"index.html", "feed.xml", "sitemap.xml"} {
+			if bytes.Contains(got[list], []byte(name)) {
+				t.Errorf("%v is listed in %v", name, list)
+			}
+		}
+	}
+	for _, list := range []string{"index.html", "feed.xml", "sitemap.xml"} {
+		if !bytes.Contains(got[list], []byte("post.html")) {
+			t.Errorf("post.html isn't listed in %v", list)
+		}
+	}
+}
+
+func TestBuildBasenameCollision(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(src, "post.md"):     "# Post\n",
+		filepath.Join(dir, "a", "x.tmpl"): "a {{len .Pages}}",
+		filepath.Join(dir, "b", "x.tmpl"): "b {{len .Pages}}",
+	}
+	for p, content := range files {
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(dir, "a", "x.tmpl"), filepath.Join(dir, "b", "x.tmpl")
+
+	out := filepath.Join(t.TempDir(), "out")
+	err := buildSite(src, out, "-extras", a+":a.txt,"+b+":b.txt")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	got := readTree(t, out)
+	for name, want := range map[string]string{
+		"a.txt": "a 1",
+		"b.txt": "b 1",
+	} {
+		if string(got[name]) != want {
+			t.Errorf("%v: got %q, want %q", name, got[name], want)
+		}
+	}
+
+	err = buildSite(src, out, "-extras", a+":x.txt,"+b+":x.txt")
+	if (err == nil) || !strings.Contains(err.Error(), a) || !strings.Contains(err.Error(), b) {
+		t.Errorf("expected an error naming both extras, got %v", err)
+	}
+
+	// Pages with the same file name in different directories collide
+	// if they're flattened into the same output directory.
+	for _, name := range []string{"a", "b"} {
+		p := filepath.Join(src, name, "x.md")
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte("<!--meta\ntitle: X\noutdir: .\n-->\nX.\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = buildSite(src, out)
+	pa, pb := filepath.Join("a", "x.md"), filepath.Join("b", "x.md")
+	if (err == nil) || !strings.Contains(err.Error(), pa) || !strings.Contains(err.Error(), pb) {
+		t.Errorf("expected an error naming both pages, got %v", err)
+	}
+}
+
+// TestBuildIncrementalConfig checks that incremental builds regenerate
+// everything if options that affect the output change and pages that
+// embed the content of other pages when those pages change.
+func TestBuildIncrementalConfig(t *testing.T) {
+	src := t.TempDir()
+	write := func(name, content string, mtime time.Time) {
+		p := filepath.Join(src, name)
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(p, mtime, mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("page.tmpl", `{{.Page.Content}}{{if eq .Page.Meta.title "Home"}}[{{content "news"}}]{{end}}`, testTime)
+	write("home.md", "<!--meta\ntitle: Home\n-->\n# Home\n", testTime)
+	write("news.md", "<!--meta\ntitle: News\n-->\nOld news.\n", testTime)
+
+	out := filepath.Join(t.TempDir(), "out")
+	build := func(args ...string) {
+		err := buildSite(src, out, append([]string{
+			"-incremental",
+			"-manifest", ".bog/manifest.json",
+			"-page", filepath.Join(src, "page.tmpl"),
+		}, args...)...)
+		if err != nil {
+			t.Fatalf("build: %v", err)
+		}
+	}
+	contains := func(name, want string) bool {
+		t.Helper()
+		content, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Contains(content, []byte(want))
+	}
+
+	build()
+	if !contains("home.html", "[<p>Old news.</p>\n]") {
+		t.Fatal("home.html doesn't embed the news")
+	}
+
+	// The sources are still older than the outputs, so only the
+	// dependency on the news page can cause home.html to be
+	// regenerated.
+	write("news.md", "<!--meta\ntitle: News\n-->\nNew news.\n", testTime.Add(time.Hour))
+	build()
+	if !contains("home.html", "[<p>New news.</p>\n]") {
+		t.Error("home.html wasn't regenerated after the news changed")
+	}
+
+	build("-anchors")
+	if !contains("home.html", `class="anchor"`) {
+		t.Error("home.html wasn't regenerated after -anchors was given")
+	}
+	build("-anchors", "-verbose", "-jobs", "1")
+	if !contains("home.html", `class="anchor"`) {
+		t.Error("home.html lost its anchor")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// genSitemap writes a sitemap listing the HTML outputs of pages, and
+// the index if index is true, to w. Locations are built by joining
+// the pages' output paths onto base.
+func genSitemap(w io.Writer, pages []*PageInfo, base string, index bool) error {
+	const layout = "2006-01-02"
+
+	var set sitemapURLSet
+	var newest time.Time
+	for _, page := range pages {
+		t := page.Meta["time"].(time.Time)
+		if t.After(newest) {
+			newest = t
+		}
+
+		var html bool
+		for _, format := range page.Outputs() {
+			html = html || (format == "html")
+		}
+		if !html {
+			continue
+		}
+
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     siteURL(base, page.OutputFormat("html")),
+			LastMod: t.Format(layout),
+		})
+	}
+
+	if index {
+		u := sitemapURL{Loc: siteURL(base, "index.html")}
+		if !newest.IsZero() {
+			u.LastMod = newest.Format(layout)
+		}
+		set.URLs = append([]sitemapURL{u}, set.URLs...)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "\t")
+	err = e.Encode(set)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
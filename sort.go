@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort orders.
+const (
+	orderAsc  = "asc"
+	orderDesc = "desc"
+)
+
+// sortPages stably sorts pages by the metadata value at key, which
+// may be a dot-separated path into nested metadata. Pages that are
+// missing the key are placed at the end regardless of the order.
+func sortPages(pages []*PageInfo, key string, desc bool) {
+	keys := strings.Split(key, ".")
+	sort.SliceStable(pages, func(i, j int) bool {
+		vi := pages[i].getMeta(keys...)
+		vj := pages[j].getMeta(keys...)
+		if (vi == nil) || (vj == nil) {
+			return (vi != nil) && (vj == nil)
+		}
+
+		c := compareMeta(vi, vj)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareMeta compares two metadata values, returning a negative
+// number if a is less than b, a positive number if a is greater than
+// b, and zero if they are equal. Times and numbers are compared as
+// such, while everything else, including mismatched types, is
+// compared by string representation.
+func compareMeta(a, b interface{}) int {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	if na, ok := toFloat(a); ok {
+		if nb, ok := toFloat(b); ok {
+			switch {
+			case na < nb:
+				return -1
+			case na > nb:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toFloat converts a numeric value to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// descKeys are the metadata keys that are sorted in descending order
+// if no order is given, so that the newest pages come first.
+var descKeys = map[string]bool{
+	"time": true,
+}
+
+// defaultOrder returns the order that key is sorted in if no order is
+// given: descending for the keys in descKeys and ascending for
+// everything else.
+func defaultOrder(key string) string {
+	if descKeys[key] {
+		return orderDesc
+	}
+	return orderAsc
+}
+
+// parseSort parses a sort specification of the form "key" or
+// "key:order", where order is either "asc" or "desc". If no order is
+// given, the key's default order is used.
+func parseSort(spec string) (key string, desc bool, err error) {
+	key, order, ok := splitPair(spec, ":")
+	if !ok {
+		key, order = spec, defaultOrder(spec)
+	}
+
+	switch order {
+	case orderAsc:
+		return key, false, nil
+	case orderDesc:
+		return key, true, nil
+	default:
+		return "", false, fmt.Errorf("invalid sort order %q", order)
+	}
+}
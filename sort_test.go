@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// syntheticPages returns n pages with shuffled times and paths.
+func syntheticPages(n int) []*PageInfo {
+	r := rand.New(rand.NewSource(1))
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pages := make([]*PageInfo, n)
+	for i, j := range r.Perm(n) {
+		pages[i] = &PageInfo{
+			Path: fmt.Sprintf("page%v.md", j),
+			Meta: map[string]interface{}{
+				"title": fmt.Sprintf("Page %v", j),
+				"time":  base.Add(time.Duration(r.Intn(n)) * time.Hour),
+			},
+		}
+	}
+	return pages
+}
+
+func BenchmarkSortSite(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			pages := syntheticPages(n)
+			sorted := make([]*PageInfo, n)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				copy(sorted, pages)
+				sortSite(sorted, "time", true)
+			}
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		spec string
+		key  string
+		desc bool
+	}{
+		{"time", "time", true},
+		{"time:asc", "time", false},
+		{"time:desc", "time", true},
+		{"title", "title", false},
+		{"title:desc", "title", true},
+		{"series.part", "series.part", false},
+	}
+	for _, test := range tests {
+		key, desc, err := parseSort(test.spec)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if (key != test.key) || (desc != test.desc) {
+			t.Errorf("%q: got %q, %v, want %q, %v", test.spec, key, desc, test.key, test.desc)
+		}
+	}
+
+	_, _, err := parseSort("time:newest")
+	if err == nil {
+		t.Errorf("expected an error for an invalid order")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Ways of handling sources that are ambiguous because they differ
+// only in their extensions.
+const (
+	ambiguousFirst = "first"
+	ambiguousError = "error"
+)
+
+// extIndex returns the index in exts of the extension of path, or -1
+// if the extension isn't in exts. Extensions are compared
+// case-insensitively.
+func extIndex(path string, exts []string) int {
+	ext := filepath.Ext(path)
+	for i, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectSources filters paths down to those that have an extension
+// listed in exts. If multiple paths differ only in their extensions,
+// the one whose extension comes first in exts is selected, unless
+// onAmbiguous is ambiguousError, in which case an error is returned
+// instead. The order of the selected paths is preserved.
+func selectSources(paths []string, exts []string, onAmbiguous string) ([]string, error) {
+	switch onAmbiguous {
+	case ambiguousFirst, ambiguousError:
+	default:
+		return nil, fmt.Errorf("unknown ambiguity handling: %q", onAmbiguous)
+	}
+
+	chosen := make(map[string]string, len(paths))
+	for _, path := range paths {
+		i := extIndex(path, exts)
+		if i < 0 {
+			continue
+		}
+
+		key := RemoveExt(path)
+		prev, ok := chosen[key]
+		if !ok {
+			chosen[key] = path
+			continue
+		}
+
+		if onAmbiguous == ambiguousError {
+			return nil, fmt.Errorf("ambiguous sources: %q and %q", prev, path)
+		}
+		if i < extIndex(prev, exts) {
+			chosen[key] = path
+		}
+	}
+
+	sources := make([]string, 0, len(chosen))
+	for _, path := range paths {
+		if chosen[RemoveExt(path)] == path {
+			sources = append(sources, path)
+		}
+	}
+	return sources, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSelectSources(t *testing.T) {
+	exts := []string{".md", ".markdown", ".html"}
+	tests := []struct {
+		name        string
+		paths       []string
+		onAmbiguous string
+		want        []string
+		err         string
+	}{
+		{
+			name:        "Unambiguous",
+			paths:       []string{"a.md", "b.markdown", "c.txt"},
+			onAmbiguous: ambiguousError,
+			want:        []string{"a.md", "b.markdown"},
+		},
+		{
+			name:        "FirstListed",
+			paths:       []string{"x.markdown", "y.md", "x.md"},
+			onAmbiguous: ambiguousFirst,
+			want:        []string{"y.md", "x.md"},
+		},
+		{
+			name:        "FirstUnlisted",
+			paths:       []string{"x.md", "x.markdown"},
+			onAmbiguous: ambiguousFirst,
+			want:        []string{"x.md"},
+		},
+		{
+			name:        "Error",
+			paths:       []string{"x.md", "x.markdown"},
+			onAmbiguous: ambiguousError,
+			err:         `ambiguous sources: "x.md" and "x.markdown"`,
+		},
+		{
+			name:        "Unknown",
+			paths:       []string{"x.md"},
+			onAmbiguous: "last",
+			err:         `unknown ambiguity handling: "last"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := selectSources(test.paths, exts, test.onAmbiguous)
+			if test.err != "" {
+				if (err == nil) || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
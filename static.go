@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/DeedleFake/bog/multierr"
+)
+
+// defaultStaticDir is the directory under the source directory that
+// static files are copied from if -static isn't given.
+const defaultStaticDir = "static"
+
+// staticDir returns the directory that static files should be copied
+// from. If -static is blank, the static directory under the source
+// directory is used if it exists. If there is no static directory,
+// ok is false.
+func (s *Site) staticDir() (dir string, ok bool) {
+	if s.flags.Static != "" {
+		return s.flags.Static, true
+	}
+
+	dir = filepath.Join(s.flags.Source, defaultStaticDir)
+	info, err := os.Stat(dir)
+	return dir, (err == nil) && info.IsDir()
+}
+
+// staticFile is a file to be copied from the static directory.
+type staticFile struct {
+	// Path is the path of the file.
+	Path string
+
+	// Rel is the path of the file relative to the static directory.
+	Rel string
+
+	// Info describes the file.
+	Info os.FileInfo
+}
+
+// findStatic returns the files in the static directory and its
+// subdirectories, skipping hidden ones unless they are included and
+// any listed in .bogignore files in the static directory, which work
+// the same way that they do in the source directory. If there is no
+// static directory, it returns nil.
+func (s *Site) findStatic() ([]staticFile, error) {
+	dir, ok := s.staticDir()
+	if !ok {
+		return nil, nil
+	}
+
+	ig := ignorer{root: dir}
+	var files []staticFile
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if (p != dir) && !s.flags.IncludeHidden && IsHidden(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		slashed := filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if p == dir {
+				slashed = ""
+			} else if ig.Ignored(slashed, true) {
+				return filepath.SkipDir
+			}
+
+			err := ig.Load(slashed)
+			if err != nil {
+				return fmt.Errorf("load %v: %w", path.Join(slashed, ignoreFile), err)
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || ig.Ignored(slashed, false) {
+			return nil
+		}
+
+		files = append(files, staticFile{Path: p, Rel: rel, Info: info})
+		return nil
+	})
+	return files, err
+}
+
+// copyStatic starts copying the static files into the same places in
+// the output directory. The copies are finished before anything else
+// is generated, so nothing generated can see a partial or stale copy.
+// Files whose copies already have the same size and a modification
+// time no older than the original are skipped unless -force is given.
+// Copies keep the modification times of the originals, so unchanged
+// files are skipped on the next build.
+func (s *Site) copyStatic(eg *multierr.MultiErr, files []staticFile) {
+	for _, file := range files {
+		file := file
+		eg.Go(func() error {
+			path := filepath.Join(s.flags.Output, file.Rel)
+			o := output{Path: path, ModTime: file.Info.ModTime(), Sources: []string{file.Path}}
+
+			if !s.flags.Force && staticUpToDate(path, file.Info) {
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				hash := sha256.Sum256(content)
+				o.Hash = hex.EncodeToString(hash[:])
+				s.addOutput(o)
+
+				infof("Skipped %q: up to date", path)
+				return nil
+			}
+
+			hash, err := copyFile(path, file.Path, file.Info)
+			if err != nil {
+				return fmt.Errorf("copy %q: %w", file.Path, err)
+			}
+			o.Hash = hash
+			s.addOutput(o)
+
+			infof("Copied %q", path)
+			return nil
+		})
+	}
+}
+
+// staticUpToDate returns true if the file at path has the same size
+// as the original described by info and was modified no earlier than
+// it.
+func staticUpToDate(path string, info os.FileInfo) bool {
+	dst, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return (dst.Size() == info.Size()) && !dst.ModTime().Before(info.ModTime())
+}
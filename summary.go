@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// moreMarker matches the comment that marks the end of a page's
+// summary.
+var moreMarker = regexp.MustCompile(`<!--\s*more\s*-->`)
+
+// summarize returns a plain text summary of the rendered HTML content
+// of a page. If the content contains a <!-- more --> comment, the
+// summary is all of the text before it. Otherwise, it is the text of
+// the first paragraph that has any, skipping over headings and
+// paragraphs that only contain images.
+func summarize(content string) string {
+	if loc := moreMarker.FindStringIndex(content); loc != nil {
+		return collapseSpace(stripHTML(content[:loc[0]]))
+	}
+
+	var sb strings.Builder
+	var depth int
+	t := html.NewTokenizer(strings.NewReader(content))
+	for {
+		switch t.Next() {
+		case html.ErrorToken:
+			if t.Err() != io.EOF {
+				// As in stripHTML, reading from a strings.Reader
+				// can't fail.
+				panic(t.Err())
+			}
+			return ""
+
+		case html.StartTagToken:
+			if name, _ := t.TagName(); string(name) == "p" {
+				depth++
+			}
+
+		case html.EndTagToken:
+			if name, _ := t.TagName(); (string(name) != "p") || (depth == 0) {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			summary := collapseSpace(sb.String())
+			if summary != "" {
+				return summary
+			}
+			sb.Reset()
+
+		case html.TextToken:
+			if depth > 0 {
+				sb.Write(t.Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/gosimple/slug"
+)
+
+// tagsDir is the directory under the output directory that tag pages
+// are written to.
+const tagsDir = "tags"
+
+// Tags returns the page's tags, as given by its "tags" metadata,
+// which can be either a single string or a list.
+func (page *PageInfo) Tags() []string {
+	switch tags := page.Meta["tags"].(type) {
+	case string:
+		return []string{tags}
+
+	case []interface{}:
+		r := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			r = append(r, fmt.Sprint(tag))
+		}
+		return r
+	}
+
+	return nil
+}
+
+// tagPage is the page listing all of the pages with a given tag.
+type tagPage struct {
+	// Tag is the name of the tag, as given by the first page found
+	// with it.
+	Tag string
+
+	// Path is the slash-separated path of the page's output relative
+	// to the output directory.
+	Path string
+
+	Pages []*PageInfo
+}
+
+// collectTags groups pages by their tags, keyed by the tags' slugs so
+// that tags differing only in case or punctuation share a page. Pages
+// keep their relative order.
+func collectTags(pages []*PageInfo) map[string]*tagPage {
+	tags := make(map[string]*tagPage)
+	for _, page := range pages {
+		seen := make(map[string]struct{})
+		for _, tag := range page.Tags() {
+			s := slug.Make(tag)
+			if _, ok := seen[s]; ok || (s == "") {
+				continue
+			}
+			seen[s] = struct{}{}
+
+			tp, ok := tags[s]
+			if !ok {
+				tp = &tagPage{Tag: tag, Path: path.Join(tagsDir, s+".html")}
+				tags[s] = tp
+			}
+			tp.Pages = append(tp.Pages, page)
+		}
+	}
+	return tags
+}
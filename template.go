@@ -1,22 +1,48 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"text/template/parse"
+	"unicode"
 
+	"github.com/DeedleFake/bog/internal/bufpool"
+	"github.com/DeedleFake/bog/markdown"
 	"github.com/gosimple/slug"
+	"github.com/russross/blackfriday/v2"
 )
 
 // tmplFuncs contains some utility functions for use in templates.
+//
+// Pages are loaded and generated concurrently, so template functions,
+// both here and those added per site, may be called from multiple
+// goroutines at once and must be safe for concurrent use. Any that
+// keep state, such as the cache in bustFunc, must synchronize access
+// to it.
 var tmplFuncs = template.FuncMap{
 	"slugify":       slug.Make,
 	"link_to_title": func(title string) string { return fmt.Sprintf("%v.html", slug.Make(title)) },
 	"link":          func(slug string) string { return fmt.Sprintf("%v.html", slug) },
 	"remove_ext":    RemoveExt,
+	"base":          path.Base,
+	"plaintext":     stripHTML,
+	"markdownify":   markdownify,
+	"excerpt":       excerpt,
+	"truncate":      truncate,
+	"where":         where,
+	"sort_by":       sortBy,
+	"toc":           toc,
 	"limit": func(length int, data interface{}) interface{} {
 		v := reflect.ValueOf(data)
 		if v.Len() < length {
@@ -26,13 +52,258 @@ var tmplFuncs = template.FuncMap{
 	},
 }
 
+// markdownify renders a string of markdown as HTML using
+// blackfriday's common extensions and task lists. Templates used by
+// bog are text templates, so the result is inserted as is without
+// being escaped. Blank input produces an empty string. Sites override
+// it with one that uses the same extensions as their pages.
+func markdownify(src string) (string, error) {
+	return markdownifyWith(blackfriday.CommonExtensions|markdown.TaskLists, src)
+}
+
+// markdownifyWith is like markdownify, but uses the given extensions.
+func markdownifyWith(extensions blackfriday.Extensions, src string) (string, error) {
+	if strings.TrimSpace(src) == "" {
+		return "", nil
+	}
+
+	md := blackfriday.New(blackfriday.WithExtensions(extensions))
+	node := md.Parse([]byte(src))
+
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+
+	var renderer blackfriday.Renderer = blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags: blackfriday.CommonHTMLFlags,
+	})
+	if extensions&markdown.TaskLists != 0 {
+		renderer = &markdown.TaskListRenderer{Renderer: renderer}
+	}
+	err := markdown.Render(buf, node, renderer)
+	if err != nil {
+		return "", fmt.Errorf("render markdown: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// excerpt returns the first n words of the plain text of content,
+// followed by an ellipsis if any words were left off. content may be
+// either a *PageInfo, in which case its content is used, or a string
+// of HTML. Whitespace between words is collapsed to single spaces. A
+// negative n is treated as 0.
+func excerpt(n int, content interface{}) (string, error) {
+	if n < 0 {
+		n = 0
+	}
+
+	var src string
+	switch content := content.(type) {
+	case *PageInfo:
+		src = content.Content
+	case string:
+		src = content
+	default:
+		return "", fmt.Errorf("cannot excerpt %T", content)
+	}
+
+	words := strings.Fields(stripHTML(src))
+	if len(words) <= n {
+		return strings.Join(words, " "), nil
+	}
+	return strings.Join(words[:n], " ") + "…", nil
+}
+
+// truncate shortens str to at most n runes, followed by an ellipsis.
+// If possible, it cuts between words rather than in the middle of
+// one. Strings that are already short enough are returned unchanged.
+// A negative n is treated as 0.
+func truncate(n int, str string) string {
+	if n < 0 {
+		n = 0
+	}
+
+	runes := []rune(str)
+	if len(runes) <= n {
+		return str
+	}
+
+	cut := n
+	for (cut > 0) && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = n
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
+
+// collapseSpace replaces each run of whitespace in str with a single
+// space and trims it from the ends.
+func collapseSpace(str string) string {
+	return strings.Join(strings.Fields(str), " ")
+}
+
+// where returns the pages whose metadata at key, which may be a
+// dot-separated path into nested metadata, is equal to value. Values
+// are compared in the same way that they are when sorting, so, for
+// example, numbers of different types are equal if they have the same
+// value. Pages without the key never match.
+func where(pages []*PageInfo, key string, value interface{}) []*PageInfo {
+	keys := strings.Split(key, ".")
+
+	var r []*PageInfo
+	for _, page := range pages {
+		v := page.getMeta(keys...)
+		if (v != nil) && (compareMeta(v, value) == 0) {
+			r = append(r, page)
+		}
+	}
+	return r
+}
+
+// sortBy returns a copy of pages stably sorted by the metadata value
+// at key, in the same way as collections are sorted. The order may be
+// given as either "asc" or "desc", and defaults to "desc" for time and
+// "asc" for everything else. Pages without the key are placed at the
+// end.
+func sortBy(pages []*PageInfo, key string, order ...string) ([]*PageInfo, error) {
+	if len(order) > 1 {
+		return nil, fmt.Errorf("expected at most one order, got %v", len(order))
+	}
+
+	spec := key
+	if len(order) == 1 {
+		spec += ":" + order[0]
+	}
+	key, desc, err := parseSort(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make([]*PageInfo, len(pages))
+	copy(r, pages)
+	sortPages(r, key, desc)
+	return r, nil
+}
+
+// missingKeyModes are the valid values of the missingkey template
+// option.
+var missingKeyModes = map[string]bool{
+	"default": true,
+	"zero":    true,
+	"error":   true,
+}
+
+// missingKeyMode returns the value of the missingkey option that
+// templates should be given for the mode selected with -missingkey.
+// In strict mode, the default is "error" instead of "default", but
+// "zero" can still be selected explicitly.
+func missingKeyMode(mode string, strict bool) string {
+	switch {
+	case (mode == "") || (mode == "default"):
+		if strict {
+			return "error"
+		}
+		return "default"
+	default:
+		return mode
+	}
+}
+
+// mergeFuncs returns a new FuncMap containing all of the functions
+// from each of the provided maps. Functions in later maps override
+// those with the same name in earlier ones.
+func mergeFuncs(maps ...template.FuncMap) template.FuncMap {
+	merged := make(template.FuncMap)
+	for _, m := range maps {
+		for name, f := range m {
+			merged[name] = f
+		}
+	}
+	return merged
+}
+
+// bustFunc returns a template function that appends a query string
+// containing a hash of a file's contents to a URL referring to that
+// file. URLs are resolved relative to each of roots in turn, and the
+// first file that exists is hashed. URLs with a host are returned
+// unchanged.
+//
+// The roots should be the directories that the files are copied or
+// generated from, not the output directory, as the copies may not have
+// been written yet, or may be left over from a previous build, when
+// the function is called. The hashes are cached, so the function
+// assumes that files don't change while it's in use. Each build gets
+// its own.
+func bustFunc(roots ...string) func(string) (string, error) {
+	var cache sync.Map
+
+	return func(raw string) (string, error) {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", fmt.Errorf("parse URL: %w", err)
+		}
+		if u.Host != "" {
+			return raw, nil
+		}
+
+		rel := filepath.FromSlash(path.Clean("/" + u.Path))
+		hash, ok := cache.Load(rel)
+		if !ok {
+			h, err := hashRoots(roots, rel)
+			if err != nil {
+				return "", fmt.Errorf("bust %q: %w", raw, err)
+			}
+			hash, _ = cache.LoadOrStore(rel, h)
+		}
+
+		q := u.Query()
+		q.Set("v", hash.(string))
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+}
+
+// hashRoots returns the hash of the first file at rel under one of
+// roots that exists.
+func hashRoots(roots []string, rel string) (hash string, err error) {
+	for _, root := range roots {
+		hash, err = hashFile(filepath.Join(root, rel))
+		if !os.IsNotExist(err) {
+			return hash, err
+		}
+	}
+	return hash, err
+}
+
+// hashFile returns a short hex-encoded hash of the contents of the
+// file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
 // loadTemplate conditionally parses a template from either def or
 // path. If path is empty, def is considered to be the source and is
 // parsed, otherwise the file at path is opened and the contents are
 // parsed.
 func loadTemplate(tmpl *template.Template, def, path string) (*template.Template, error) {
 	if path == "" {
-		return tmpl.Parse(def)
+		tmpl, err := tmpl.Parse(def)
+		if err != nil {
+			return tmpl, err
+		}
+		return tmpl, checkCycles(tmpl)
 	}
 
 	file, err := os.Open(path)
@@ -47,5 +318,89 @@ func loadTemplate(tmpl *template.Template, def, path string) (*template.Template
 		return tmpl, fmt.Errorf("copy: %w", err)
 	}
 
-	return tmpl.Parse(sb.String())
+	tmpl, err = tmpl.Parse(sb.String())
+	if err != nil {
+		return tmpl, err
+	}
+	return tmpl, checkCycles(tmpl)
+}
+
+// checkCycles returns an error if any of the templates associated
+// with tmpl unconditionally include themselves, either directly or via
+// other templates. text/template would otherwise only find out at
+// execution time by overflowing the stack. Includes inside of if,
+// range, and with actions are not considered, as recursion through
+// them can terminate and is a legitimate way to render nested data.
+func checkCycles(tmpl *template.Template) error {
+	refs := make(map[string][]string)
+	var names []string
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		refs[t.Name()] = templateRefs(t.Tree.Root, nil)
+		names = append(names, t.Name())
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(refs))
+	var stack []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			for i, n := range stack {
+				if n == name {
+					return fmt.Errorf("template include cycle: %v", strings.Join(append(stack[i:], name), " -> "))
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, ref := range refs[name] {
+			err := visit(ref)
+			if err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, name := range names {
+		err := visit(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateRefs appends the names of the templates unconditionally
+// included by node to refs.
+func templateRefs(node parse.Node, refs []string) []string {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return refs
+		}
+		for _, n := range node.Nodes {
+			refs = templateRefs(n, refs)
+		}
+	case *parse.TemplateNode:
+		refs = append(refs, node.Name)
+	}
+	return refs
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestBust(t *testing.T) {
+	static, src := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(static, "style.css"): "body {}",
+		filepath.Join(src, "style.css"):    "shadowed",
+		filepath.Join(src, "script.js"):    "alert()",
+	}
+	for p, content := range files {
+		err := ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := func(p string) string {
+		h, err := hashFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	bust := bustFunc(static, src)
+	tests := []struct {
+		url, want string
+	}{
+		{"/style.css", "/style.css?v=" + hash(filepath.Join(static, "style.css"))},
+		{"script.js?a=b", "script.js?a=b&v=" + hash(filepath.Join(src, "script.js"))},
+		{"https://example.com/style.css", "https://example.com/style.css"},
+	}
+	for _, test := range tests {
+		got, err := bust(test.url)
+		if err != nil {
+			t.Errorf("%q: %v", test.url, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.url, got, test.want)
+		}
+	}
+
+	_, err := bust("missing.css")
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "missing.css") {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n         int
+		str, want string
+	}{
+		{20, "Short enough", "Short enough"},
+		{9, "Hello there world", "Hello…"},
+		{5, "Unbreakable", "Unbre…"},
+		{0, "Anything", "…"},
+		{-1, "Anything", "…"},
+		{-1, "", ""},
+	}
+	for _, test := range tests {
+		if got := truncate(test.n, test.str); got != test.want {
+			t.Errorf("truncate(%v, %q): got %q, want %q", test.n, test.str, got, test.want)
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	const content = "<p>One <em>two</em>\n   three four.</p>"
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{10, "One two three four."},
+		{2, "One two…"},
+		{0, "…"},
+		{-3, "…"},
+	}
+	for _, test := range tests {
+		got, err := excerpt(test.n, content)
+		if err != nil {
+			t.Errorf("excerpt(%v): %v", test.n, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("excerpt(%v): got %q, want %q", test.n, got, test.want)
+		}
+	}
+
+	_, err := excerpt(1, 3)
+	if err == nil {
+		t.Error("excerpt of an int didn't fail")
+	}
+}
+
+func TestLoadTemplateCycle(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{
+			name: "TwoTemplates",
+			src:  `{{define "a"}}A{{template "b" .}}{{end}}{{define "b"}}B{{template "a" .}}{{end}}{{template "a" .}}`,
+			err:  "template include cycle: a -> b -> a",
+		},
+		{
+			name: "Self",
+			src:  `{{define "a"}}{{template "a"}}{{end}}`,
+			err:  "template include cycle: a -> a",
+		},
+		{
+			name: "Conditional",
+			src:  `{{define "tree"}}{{range .}}{{template "tree" .Children}}{{end}}{{end}}{{template "tree" .}}`,
+		},
+		{
+			name: "NoCycle",
+			src:  `{{define "a"}}{{template "b"}}{{end}}{{define "b"}}B{{end}}{{template "a"}}{{template "b"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "page.tmpl")
+			err := ioutil.WriteFile(path, []byte(test.src), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = loadTemplate(template.New("page"), "", path)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if (err == nil) || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
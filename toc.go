@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gosimple/slug"
+	"github.com/russross/blackfriday/v2"
+	"golang.org/x/net/html"
+)
+
+// A heading is a heading in the content of a page.
+type heading struct {
+	// Level is the level of the heading, from 1 for an <h1> to 6 for an
+	// <h6>.
+	Level int
+
+	// Text is the plain text of the heading.
+	Text string
+
+	// ID is the heading's anchor ID, which is unique within the page.
+	ID string
+
+	// pending is true if the heading's ID is a placeholder until the
+	// page's content template has been executed. If any of a page's
+	// headings contain template actions, all of them are pending, so
+	// that their IDs can still be assigned in document order.
+	pending bool
+
+	// base is the ID that a pending heading should get, before it is
+	// made unique. It is blank if the heading's text contains template
+	// actions, in which case Text is also a placeholder.
+	base string
+}
+
+// findHeadings returns the headings in the markdown document rooted at
+// root, in order, and gives each of the heading nodes an ID so that
+// the HTML renderer outputs it. Headings that were given an ID
+// explicitly with the {#id} syntax keep it, and the rest get the
+// slugified version of their text, with a number appended if
+// necessary to make it unique. The IDs only depend on the document,
+// so they are stable across builds.
+//
+// If delim isn't blank, the document is a template with it as its
+// left delimiter. If the text of any heading without an explicit ID
+// contains it, that text isn't known until the template is executed,
+// so all of the headings are left pending. See resolveHeadings.
+func findHeadings(root *blackfriday.Node, delim string) []heading {
+	var headings []heading
+	var nodes []*blackfriday.Node
+	var pending bool
+	root.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering || (node.Type != blackfriday.Heading) || node.IsTitleblock {
+			return blackfriday.GoToNext
+		}
+
+		text := nodeText(node)
+		id := node.HeadingID
+		if (delim != "") && (id == "") && strings.Contains(text, delim) {
+			pending = true
+			text = fmt.Sprintf("\x00heading-text:%v\x00", len(headings))
+		} else {
+			if id == "" {
+				id = slug.Make(text)
+			}
+			if id == "" {
+				id = "heading"
+			}
+		}
+
+		nodes = append(nodes, node)
+		headings = append(headings, heading{
+			Level: node.Level,
+			Text:  text,
+			base:  id,
+		})
+		return blackfriday.SkipChildren
+	})
+
+	taken := make(map[string]bool)
+	for i := range headings {
+		h := &headings[i]
+		if pending {
+			h.ID = fmt.Sprintf("\x00heading:%v\x00", i)
+			h.pending = true
+		} else {
+			h.ID = uniqueID(taken, h.base)
+			h.base = ""
+		}
+		nodes[i].HeadingID = h.ID
+	}
+	return headings
+}
+
+// resolveHeadings finds the text of the page's headings whose text
+// contains template actions in content, the page's rendered HTML
+// after its content template has been executed, and gives all of the
+// pending headings IDs in document order the same way that
+// findHeadings does. It returns a replacer that replaces the
+// placeholders for their text and IDs, which may have been output by
+// the anchor renderer or toc, in the page's rendered content.
+func (page *PageInfo) resolveHeadings(content string) *strings.Replacer {
+	pending := make(map[string]int)
+	for i, h := range page.headings {
+		if h.pending && (h.base == "") {
+			pending[h.ID] = i
+		}
+	}
+	if len(pending) == 0 {
+		return strings.NewReplacer()
+	}
+
+	texts := make(map[int]string, len(pending))
+	current, skip := -1, 0
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		switch {
+		case (tt == html.StartTagToken) && (current < 0) && isHeading(tok.Data):
+			for _, attr := range tok.Attr {
+				if i, ok := pending[attr.Val]; ok && (attr.Key == "id") {
+					current = i
+				}
+			}
+
+		case current < 0:
+
+		case (tt == html.StartTagToken) && ((skip > 0) || hasAttr(tok, "aria-hidden", "true")):
+			skip++
+
+		case (tt == html.EndTagToken) && (skip > 0):
+			skip--
+
+		case (tt == html.TextToken) && (skip == 0):
+			sb.WriteString(tok.Data)
+
+		case (tt == html.EndTagToken) && isHeading(tok.Data):
+			texts[current] = collapseSpace(sb.String())
+			current = -1
+			sb.Reset()
+		}
+	}
+
+	taken := make(map[string]bool)
+	oldnew := make([]string, 0, 2*len(page.headings)+2*len(pending))
+	for i := range page.headings {
+		h := &page.headings[i]
+		id := h.base
+		if id == "" {
+			text := texts[i]
+			id = slug.Make(text)
+			if id == "" {
+				id = "heading"
+			}
+
+			oldnew = append(oldnew, h.Text, html.EscapeString(text))
+			h.Text = text
+		}
+		id = uniqueID(taken, id)
+
+		oldnew = append(oldnew, h.ID, id)
+		h.ID = id
+		h.pending = false
+		h.base = ""
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// isHeading returns true if tag is the name of an HTML heading
+// element.
+func isHeading(tag string) bool {
+	return (len(tag) == 2) && (tag[0] == 'h') && (tag[1] >= '1') && (tag[1] <= '6')
+}
+
+// hasAttr returns true if tok has the attribute key with the value
+// val.
+func hasAttr(tok html.Token, key, val string) bool {
+	for _, attr := range tok.Attr {
+		if (attr.Key == key) && (attr.Val == val) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueID returns id, or id with the lowest number that makes it
+// unique appended to it if it is already taken, and marks the result
+// as taken.
+func uniqueID(taken map[string]bool, id string) string {
+	unique := id
+	for n := 1; taken[unique]; n++ {
+		unique = fmt.Sprintf("%v-%v", id, n)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// nodeText returns the plain text content of node and its children.
+func nodeText(node *blackfriday.Node) string {
+	var sb strings.Builder
+	node.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && ((node.Type == blackfriday.Text) || (node.Type == blackfriday.Code)) {
+			sb.Write(node.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return collapseSpace(sb.String())
+}
+
+// toc is a template function that returns a table of contents for
+// page as a nested HTML list of links to its headings. Optionally, the
+// lowest and highest levels of headings to include may be given,
+// which default to 1 and 6. If the page has no headings at those
+// levels, the result is empty.
+func toc(page *PageInfo, levels ...int) (string, error) {
+	min, max := 1, 6
+	switch len(levels) {
+	case 0:
+	case 2:
+		max = levels[1]
+		fallthrough
+	case 1:
+		min = levels[0]
+	default:
+		return "", fmt.Errorf("expected at most two heading levels, got %v", len(levels))
+	}
+	if (min < 1) || (max > 6) || (min > max) {
+		return "", fmt.Errorf("invalid heading levels %v to %v", min, max)
+	}
+
+	var sb strings.Builder
+	var stack []int
+	for _, h := range page.headings {
+		if (h.Level < min) || (h.Level > max) {
+			continue
+		}
+
+		for (len(stack) > 1) && (h.Level < stack[len(stack)-1]) {
+			stack = stack[:len(stack)-1]
+			sb.WriteString("</li></ul>")
+		}
+		switch {
+		case len(stack) == 0:
+			sb.WriteString(`<nav class="toc"><ul><li>`)
+			stack = append(stack, h.Level)
+		case h.Level > stack[len(stack)-1]:
+			sb.WriteString("<ul><li>")
+			stack = append(stack, h.Level)
+		default:
+			sb.WriteString("</li><li>")
+		}
+
+		fmt.Fprintf(&sb, `<a href="#%v">%v</a>`, html.EscapeString(h.ID), html.EscapeString(h.Text))
+	}
+	if len(stack) == 0 {
+		return "", nil
+	}
+
+	sb.WriteString(strings.Repeat("</li></ul>", len(stack)))
+	sb.WriteString("</nav>")
+	return sb.String(), nil
+}
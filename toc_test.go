@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTOCTemplateHeadings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.md")
+	err := ioutil.WriteFile(path, []byte(`<!--meta
+title: Hello
+-->
+{{toc .Page}}
+
+# {{.Data.title}}
+
+## Static
+
+## {{.Page.Meta.title}}
+
+## Hello
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := LoadPage(path, map[string]interface{}{"title": "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `<nav class="toc"><ul><li><a href="#hello">Hello</a><ul><li><a href="#static">Static</a></li><li><a href="#hello-1">Hello</a></li><li><a href="#hello-2">Hello</a></li></ul></li></ul></nav>`
+	got, err := toc(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("toc:\ngot:  %v\nwant: %v", got, want)
+	}
+	if !strings.Contains(page.Content, want) {
+		t.Errorf("content doesn't contain the table of contents:\n%v", page.Content)
+	}
+
+	for _, id := range []string{"hello", "static", "hello-1", "hello-2"} {
+		if !strings.Contains(page.Content, `id="`+id+`"`) {
+			t.Errorf("content has no heading with ID %q:\n%v", id, page.Content)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// commit is the VCS revision that bog was built from. It can be set
+// at build time with
+//
+//	go build -ldflags "-X main.commit=$(git rev-parse HEAD)"
+var commit string
+
+// version returns a description of the version of bog that is
+// running, including the module path and version, the commit if it is
+// known, and the Go version used to build it.
+func version() string {
+	path, v := "github.com/DeedleFake/bog", "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok && (info.Main.Path != "") {
+		path = info.Main.Path
+		if info.Main.Version != "" {
+			v = info.Main.Version
+		}
+	}
+
+	s := fmt.Sprintf("%v %v", path, v)
+	if commit != "" {
+		s += fmt.Sprintf(" (%v)", commit)
+	}
+	return s + " " + runtime.Version()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	defer func(c string) { commit = c }(commit)
+
+	commit = ""
+	v := version()
+	if !strings.HasPrefix(v, "github.com/DeedleFake/bog ") {
+		t.Errorf("version %q doesn't start with the module path", v)
+	}
+	if !strings.HasSuffix(v, " "+runtime.Version()) {
+		t.Errorf("version %q doesn't end with the Go version", v)
+	}
+
+	commit = "abc123"
+	if v := version(); !strings.Contains(v, " (abc123) ") {
+		t.Errorf("version %q doesn't include the commit", v)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// defaultWordsPerMinute is the reading speed that reading times are
+// estimated with if none is given.
+const defaultWordsPerMinute = 200
+
+// countWords returns the number of words in the text of the markdown
+// document rooted at root. Code blocks and raw HTML are skipped, so
+// long listings don't inflate the count.
+func countWords(root *blackfriday.Node) int {
+	var n int
+	root.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if !entering {
+			return blackfriday.GoToNext
+		}
+
+		switch node.Type {
+		case blackfriday.CodeBlock, blackfriday.HTMLBlock, blackfriday.HTMLSpan:
+			return blackfriday.SkipChildren
+		case blackfriday.Text, blackfriday.Code:
+			n += len(strings.Fields(string(node.Literal)))
+		}
+		return blackfriday.GoToNext
+	})
+	return n
+}
+
+// readingTime returns the estimated number of minutes that it takes
+// to read the given number of words at wpm words per minute, rounded
+// up. Any text at all takes at least a minute.
+func readingTime(words, wpm int) int {
+	if wpm <= 0 {
+		wpm = defaultWordsPerMinute
+	}
+	return (words + wpm - 1) / wpm
+}